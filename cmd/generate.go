@@ -6,12 +6,21 @@ import (
 )
 
 var (
-	generateCmd = &cobra.Command{
+	generateSeed int64
+	generateCmd  = &cobra.Command{
 		Use:   "generate",
 		Short: "Command to generate images/meta",
 		Long:  "Generate images/metadata based on supplied files/config",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			_, err := generator.Generate(cfg, nil)
+			// the flag only overrides settings.seed when given, so --seed 0 is a seed like any other
+			if cmd.Flags().Changed("seed") {
+				cfg.Settings.Seed = &generateSeed
+			}
+			g, err := generator.New(cfg)
+			if err != nil {
+				return err
+			}
+			_, err = g.Generate(cmd.Context())
 			if err != nil {
 				return err
 			}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/clickpop/looks/pkg/generator"
+	"github.com/spf13/cobra"
+)
+
+var (
+	inspectCmd = &cobra.Command{
+		Use:          "inspect <file>",
+		Short:        "Command to show metadata embedded in an image",
+		Long:         "Print the text chunks of a png, including the token metadata written by generate when output.embed-meta is set",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			texts, err := generator.ReadPNGText(file)
+			if err != nil {
+				return fmt.Errorf("%s: %w", args[0], err)
+			}
+			if len(texts) == 0 {
+				return fmt.Errorf("%s has no embedded metadata", args[0])
+			}
+			for _, text := range texts {
+				value := text.Text
+				var pretty bytes.Buffer
+				if strings.HasPrefix(value, "[") || strings.HasPrefix(value, "{") {
+					if json.Indent(&pretty, []byte(value), "", "  ") == nil {
+						value = pretty.String()
+					}
+				}
+				fmt.Printf("%s: %s\n", text.Keyword, value)
+			}
+			return nil
+		},
+	}
+)
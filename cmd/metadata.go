@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/clickpop/looks/pkg/generator"
+	"github.com/spf13/cobra"
+)
+
+var (
+	metaDryRun  bool
+	metadataCmd = &cobra.Command{
+		Use:   "metadata",
+		Short: "Commands to update generated metadata",
+		Long:  "Rewrite the json metadata files in output.local.directory, keeping everything else generate produced",
+	}
+	metadataSetCmd = &cobra.Command{
+		Use:          "set <field> <template>",
+		Short:        "Set a field of every metadata file",
+		Long:         "Set a field such as image or external_url of every metadata file. The template can use the {id}, {filename}, {hash}, {cid} and {image-cid} placeholders of output.image-uri",
+		Args:         cobra.ExactArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return rewriteMeta(args[0], args[1])
+		},
+	}
+	metadataSetBaseURICmd = &cobra.Command{
+		Use:          "set-base-uri <uri>",
+		Short:        "Point the image of every metadata file to a base uri",
+		Long:         "Set the image field of every metadata file, and every other link to the same image, to the image filename appended to the base uri",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return rewriteMeta(generator.ImageField(cfg.Output.MetaFormat), strings.TrimSuffix(args[0], "/")+"/{filename}")
+		},
+	}
+)
+
+func init() {
+	metadataCmd.PersistentFlags().BoolVar(&metaDryRun, "dry-run", false, "Print the changes without writing them")
+	metadataCmd.AddCommand(metadataSetCmd)
+	metadataCmd.AddCommand(metadataSetBaseURICmd)
+}
+
+func rewriteMeta(field string, template string) error {
+	changes, err := generator.RewriteMeta(cfg, field, template)
+	if err != nil {
+		return err
+	}
+	if metaDryRun {
+		for _, change := range changes {
+			fmt.Print(change.Diff())
+		}
+		fmt.Printf("%d files would change\n", len(changes))
+		return nil
+	}
+	if err := generator.ApplyMetaChanges(changes); err != nil {
+		return err
+	}
+	fmt.Printf("Updated %d files\n", len(changes))
+	return nil
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/clickpop/looks/pkg/generator"
+	"github.com/spf13/cobra"
+)
+
+var (
+	reportFormat string
+	reportOut    string
+	reportCmd    = &cobra.Command{
+		Use:          "report [directory]",
+		Short:        "Command to report on a generated collection",
+		Long:         "Compare a generated collection with collections planned from its config, which accounts for rules, supplies and uniqueness. Reads the collection.json manifest of the output directory, output.local.directory unless given, or its json or jsonl metadata when there is no manifest",
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manifest, err := loadManifest(args)
+			if err != nil {
+				return err
+			}
+			report, err := generator.BuildReport(cfg, manifest)
+			if err != nil {
+				return err
+			}
+
+			var content string
+			switch reportFormat {
+			case "markdown", "md":
+				content = report.Markdown()
+			case "html":
+				content, err = report.HTML()
+				if err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("unsupported report format %q, supported formats are markdown and html", reportFormat)
+			}
+
+			return writeReport(content)
+		},
+	}
+	cooccurrenceFormat string
+	cooccurrenceCmd    = &cobra.Command{
+		Use:          "cooccurrence [directory]",
+		Short:        "Command to report how often pieces appear together",
+		Long:         "Count how often every two pieces of different attributes appear on the same token and their lift, how much more often they appear together than if they were picked independently. Writes csv, or an html heatmap with --format html",
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manifest, err := loadManifest(args)
+			if err != nil {
+				return err
+			}
+			cooccurrence, err := generator.BuildCooccurrence(cfg, manifest)
+			if err != nil {
+				return err
+			}
+
+			var content string
+			switch cooccurrenceFormat {
+			case "csv":
+				var data []byte
+				data, err = cooccurrence.CSV()
+				content = string(data)
+			case "html":
+				content, err = cooccurrence.HTML()
+			default:
+				return fmt.Errorf("unsupported co-occurrence format %q, supported formats are csv and html", cooccurrenceFormat)
+			}
+			if err != nil {
+				return err
+			}
+			return writeReport(content)
+		},
+	}
+)
+
+// loadManifest reads the collection in the directory given as argument, output.local.directory otherwise
+func loadManifest(args []string) (*generator.Manifest, error) {
+	dir := cfg.Output.Local.Directory
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	return generator.LoadManifest(cfg, dir)
+}
+
+func writeReport(content string) error {
+	if reportOut == "" {
+		fmt.Print(content)
+		return nil
+	}
+	return os.WriteFile(reportOut, []byte(content), 0666)
+}
+
+func init() {
+	reportCmd.Flags().StringVar(&reportFormat, "format", "markdown", "Report format, markdown or html")
+	reportCmd.PersistentFlags().StringVarP(&reportOut, "out", "o", "", "File to write the report to instead of stdout")
+	cooccurrenceCmd.Flags().StringVar(&cooccurrenceFormat, "format", "csv", "Output format, csv or html")
+	reportCmd.AddCommand(cooccurrenceCmd)
+}
@@ -1,8 +1,10 @@
 package cmd
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
 	"strings"
 
 	"github.com/clickpop/looks/pkg/config"
@@ -32,7 +34,9 @@ var (
 )
 
 func Execute() error {
-	return rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return rootCmd.ExecuteContext(ctx)
 }
 
 func init() {
@@ -43,12 +47,18 @@ func init() {
 	generateCmd.PersistentFlags().BoolVar(&cfg.Output.IncludeMeta, "meta", true, "If generator should build meta")
 	generateCmd.PersistentFlags().Float64Var(&cfg.Output.ImageCount, "count", 100, "Number of assets to create")
 	generateCmd.PersistentFlags().Float64Var(&cfg.Settings.MaxWorkers, "workers", 3, "Number of workers to spin up. WARNING: Setting this higher than default will use more resources and might make the program unstable")
+	generateCmd.PersistentFlags().Int64Var(&generateSeed, "seed", 0, "Seed for the random generator. Runs with the same config and seed produce identical output. A random seed is used when unset")
 	viper.BindPFlag("output.image-count", generateCmd.PersistentFlags().Lookup("count"))
 	viper.BindPFlag("output.include-meta", generateCmd.PersistentFlags().Lookup("meta"))
-	viper.BindPFlag("output.num-workers", generateCmd.PersistentFlags().Lookup("workers"))
-	initConfig()
+	viper.BindPFlag("settings.max-workers", generateCmd.PersistentFlags().Lookup("workers"))
+	cobra.OnInitialize(initConfig)
 	rootCmd.AddCommand(generateCmd)
 	rootCmd.AddCommand(initCmd)
+	rootCmd.AddCommand(validateCmd)
+	rootCmd.AddCommand(inspectCmd)
+	rootCmd.AddCommand(metadataCmd)
+	rootCmd.AddCommand(reportCmd)
+	rootCmd.AddCommand(simulateCmd)
 }
 
 func initConfig() {
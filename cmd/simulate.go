@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/clickpop/looks/pkg/generator"
+	"github.com/spf13/cobra"
+)
+
+var (
+	simulateCount int
+	simulateCmd   = &cobra.Command{
+		Use:          "simulate",
+		Short:        "Command to simulate piece selection",
+		Long:         "Draw pieces many times with the rules, minimum rarity and supplies of the config without rendering anything, printing the share of every piece next to its share in planned collections, the unique combinations the rules and supplies allow and the chance of duplicate draws at output.image-count",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			simulation, err := generator.Simulate(cfg, simulateCount)
+			if err != nil {
+				return err
+			}
+			fmt.Print(simulation)
+			return nil
+		},
+	}
+)
+
+func init() {
+	simulateCmd.Flags().IntVarP(&simulateCount, "count", "n", 10000, "Number of draws to simulate")
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/clickpop/looks/pkg/generator"
+	"github.com/spf13/cobra"
+)
+
+var (
+	validateCmd = &cobra.Command{
+		Use:          "validate",
+		Short:        "Command to validate config/pieces",
+		Long:         "Validate the supplied config and every piece file it references, reporting all problems at once",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := os.Stat(cfgFile); err != nil {
+				return err
+			}
+			problems := generator.Validate(cfg)
+			for _, problem := range problems {
+				fmt.Println(problem)
+			}
+			if len(problems) > 0 {
+				return fmt.Errorf("found %d problems in %s", len(problems), cfgFile)
+			}
+			fmt.Printf("%s is valid\n", cfgFile)
+			return nil
+		},
+	}
+)
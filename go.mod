@@ -7,6 +7,6 @@ require (
 	github.com/spf13/afero v1.8.1 // indirect
 	github.com/spf13/cobra v1.3.0
 	github.com/spf13/viper v1.10.1
-	golang.org/x/sys v0.0.0-20220224120231-95c6836cb0e7 // indirect
+	golang.org/x/image v0.18.0
 	gopkg.in/ini.v1 v1.66.4 // indirect
 )
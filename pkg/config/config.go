@@ -6,11 +6,30 @@ import (
 )
 
 type MetaFormat string
+type RarityMethod string
 type DescriptionFormat string
+type ImageFormat string
 
 const (
-	JSON MetaFormat = "json"
-	CSV  MetaFormat = "csv"
+	JSON     MetaFormat = "json"
+	CSV      MetaFormat = "csv"
+	Metaplex MetaFormat = "metaplex"
+	TZIP21   MetaFormat = "tzip21"
+	CIP25    MetaFormat = "cip25"
+	ERC1155  MetaFormat = "erc1155"
+	JSONL    MetaFormat = "jsonl"
+)
+
+const (
+	StatisticalRarity RarityMethod = "statistical"
+	RarityScore       RarityMethod = "rarity-score"
+)
+
+const (
+	PNG  ImageFormat = "png"
+	JPEG ImageFormat = "jpeg"
+	GIF  ImageFormat = "gif"
+	WebP ImageFormat = "webp"
 )
 
 type Config struct {
@@ -19,6 +38,7 @@ type Config struct {
 	Settings     ConfigSettings         `json:"settings" yaml:"settings" toml:"settings" mapstructure:"settings"`
 	Attributes   map[string]ConfigPiece `json:"attributes" yaml:"attributes" toml:"attributes" mapstructure:"attributes"`
 	Descriptions ConfigDescriptions     `json:"descriptions" yaml:"descriptions" toml:"descriptions" mapstructure:"descriptions"`
+	Rules        ConfigRules            `json:"rules" yaml:"rules" toml:"rules" mapstructure:"rules"`
 }
 type InputObject struct {
 	Local InputLocalObject `json:"local" yaml:"local" toml:"local" mapstructure:"local"`
@@ -30,24 +50,102 @@ type InputLocalObject struct {
 }
 
 type OutputObject struct {
-	Local         OutputLocalObject `json:"local" yaml:"local" toml:"local" mapstructure:"local"`
-	Internal      bool              `json:"internal" yaml:"internal" toml:"internal" mapstructure:"internal"`
-	ImageCount    float64           `json:"image-count" yaml:"image-count" toml:"image-count" mapstructure:"image-count"`
-	IncludeMeta   bool              `json:"include-meta" yaml:"include-meta" toml:"include-meta" mapstructure:"include-meta"`
-	MetaFormat    MetaFormat        `json:"meta-format" yaml:"meta-format" toml:"meta-format" mapstructure:"meta-format"`
-	MinimumRarity string            `json:"minimum-rarity" yaml:"minimum-rarity" toml:"minimum-rarity" mapstructure:"minimum-rarity"`
+	Local          OutputLocalObject `json:"local" yaml:"local" toml:"local" mapstructure:"local"`
+	Internal       bool              `json:"internal" yaml:"internal" toml:"internal" mapstructure:"internal"`
+	ImageCount     float64           `json:"image-count" yaml:"image-count" toml:"image-count" mapstructure:"image-count"`
+	IncludeMeta    bool              `json:"include-meta" yaml:"include-meta" toml:"include-meta" mapstructure:"include-meta"`
+	MetaFormat     MetaFormat        `json:"meta-format" yaml:"meta-format" toml:"meta-format" mapstructure:"meta-format"`
+	CSV            bool              `json:"csv" yaml:"csv" toml:"csv" mapstructure:"csv"`
+	Manifest       bool              `json:"manifest" yaml:"manifest" toml:"manifest" mapstructure:"manifest"`
+	RarityRank     OutputRarityRank  `json:"rarity-rank" yaml:"rarity-rank" toml:"rarity-rank" mapstructure:"rarity-rank"`
+	MinimumRarity  string            `json:"minimum-rarity" yaml:"minimum-rarity" toml:"minimum-rarity" mapstructure:"minimum-rarity"`
+	Probability    bool              `json:"probability" yaml:"probability" toml:"probability" mapstructure:"probability"`
+	ImageFormat    ImageFormat       `json:"image-format" yaml:"image-format" toml:"image-format" mapstructure:"image-format"`
+	PNGCompression string            `json:"png-compression" yaml:"png-compression" toml:"png-compression" mapstructure:"png-compression"`
+	PNGPalette     bool              `json:"png-palette" yaml:"png-palette" toml:"png-palette" mapstructure:"png-palette"`
+	JPEGQuality    int               `json:"jpeg-quality" yaml:"jpeg-quality" toml:"jpeg-quality" mapstructure:"jpeg-quality"`
+	JPEGBackground string            `json:"jpeg-background" yaml:"jpeg-background" toml:"jpeg-background" mapstructure:"jpeg-background"`
+	GIFColors      int               `json:"gif-colors" yaml:"gif-colors" toml:"gif-colors" mapstructure:"gif-colors"`
+	EmbedMeta      bool              `json:"embed-meta" yaml:"embed-meta" toml:"embed-meta" mapstructure:"embed-meta"`
+	BaseURI        string            `json:"base-uri" yaml:"base-uri" toml:"base-uri" mapstructure:"base-uri"`
+	ImageURI       string            `json:"image-uri" yaml:"image-uri" toml:"image-uri" mapstructure:"image-uri"`
+	ExternalURL    string            `json:"external-url" yaml:"external-url" toml:"external-url" mapstructure:"external-url"`
+	IPFS           bool              `json:"ipfs" yaml:"ipfs" toml:"ipfs" mapstructure:"ipfs"`
+	CARFile        string            `json:"car-file" yaml:"car-file" toml:"car-file" mapstructure:"car-file"`
+	Metaplex       OutputMetaplex    `json:"metaplex" yaml:"metaplex" toml:"metaplex" mapstructure:"metaplex"`
+	Tezos          OutputTezos       `json:"tezos" yaml:"tezos" toml:"tezos" mapstructure:"tezos"`
+	Cardano        OutputCardano     `json:"cardano" yaml:"cardano" toml:"cardano" mapstructure:"cardano"`
+	ERC1155        OutputERC1155     `json:"erc1155" yaml:"erc1155" toml:"erc1155" mapstructure:"erc1155"`
 }
 
 type OutputLocalObject struct {
 	Directory string `json:"directory" yaml:"directory" toml:"directory" mapstructure:"directory"`
 }
 
+// OutputRarityRank ranks the tokens of a collection by the frequency of their pieces once it is generated.
+// Ranking is disabled without a method, Inject adds the rank and score to the metadata of every token
+type OutputRarityRank struct {
+	Method RarityMethod `json:"method" yaml:"method" toml:"method" mapstructure:"method"`
+	Inject bool         `json:"inject" yaml:"inject" toml:"inject" mapstructure:"inject"`
+}
+
+// OutputMetaplex holds the collection-level fields of the metaplex meta format
+type OutputMetaplex struct {
+	Symbol               string             `json:"symbol" yaml:"symbol" toml:"symbol" mapstructure:"symbol"`
+	SellerFeeBasisPoints int                `json:"seller-fee-basis-points" yaml:"seller-fee-basis-points" toml:"seller-fee-basis-points" mapstructure:"seller-fee-basis-points"`
+	Creators             []MetaplexCreator  `json:"creators" yaml:"creators" toml:"creators" mapstructure:"creators"`
+	Collection           MetaplexCollection `json:"collection" yaml:"collection" toml:"collection" mapstructure:"collection"`
+}
+
+type MetaplexCreator struct {
+	Address string `json:"address" yaml:"address" toml:"address" mapstructure:"address"`
+	Share   int    `json:"share" yaml:"share" toml:"share" mapstructure:"share"`
+}
+
+type MetaplexCollection struct {
+	Name   string `json:"name" yaml:"name" toml:"name" mapstructure:"name"`
+	Family string `json:"family" yaml:"family" toml:"family" mapstructure:"family"`
+}
+
+// OutputTezos holds the collection-level fields of the tzip21 meta format. ThumbnailURI is a
+// template like image-uri, the image is used as thumbnail when unset
+type OutputTezos struct {
+	Symbol       string   `json:"symbol" yaml:"symbol" toml:"symbol" mapstructure:"symbol"`
+	Creators     []string `json:"creators" yaml:"creators" toml:"creators" mapstructure:"creators"`
+	ThumbnailURI string   `json:"thumbnail-uri" yaml:"thumbnail-uri" toml:"thumbnail-uri" mapstructure:"thumbnail-uri"`
+}
+
+// OutputERC1155 configures the erc1155 meta format. With Properties set the traits are written
+// as a properties object instead of an attributes list
+type OutputERC1155 struct {
+	Properties   bool                `json:"properties" yaml:"properties" toml:"properties" mapstructure:"properties"`
+	Localization ERC1155Localization `json:"localization" yaml:"localization" toml:"localization" mapstructure:"localization"`
+}
+
+// ERC1155Localization points clients to the translations of the metadata. URI is a pattern
+// containing {locale}, and optionally {id}, substituted by the client
+type ERC1155Localization struct {
+	URI     string   `json:"uri" yaml:"uri" toml:"uri" mapstructure:"uri"`
+	Default string   `json:"default" yaml:"default" toml:"default" mapstructure:"default"`
+	Locales []string `json:"locales" yaml:"locales" toml:"locales" mapstructure:"locales"`
+}
+
+// OutputCardano holds the collection-level fields of the cip25 meta format. Asset names are the
+// asset prefix followed by the token id
+type OutputCardano struct {
+	PolicyID    string `json:"policy-id" yaml:"policy-id" toml:"policy-id" mapstructure:"policy-id"`
+	AssetPrefix string `json:"asset-prefix" yaml:"asset-prefix" toml:"asset-prefix" mapstructure:"asset-prefix"`
+}
+
 type ConfigSettings struct {
-	PieceOrder []string                   `json:"piece-order" yaml:"piece-order" toml:"piece-order" mapstructure:"piece-order"`
-	Stats      map[string]ConfigStat      `json:"stats" yaml:"stats" toml:"stats" mapstructure:"stats"`
-	Attributes map[string]ConfigAttribute `json:"attributes" yaml:"attributes" toml:"attributes" mapstructure:"attributes"`
-	Rarity     ConfigRarity               `json:"rarity" yaml:"rarity" toml:"rarity" mapstructure:"rarity"`
-	MaxWorkers float64                    `json:"max-workers" yaml:"max-workers" toml:"max-workers" mapstructure:"max-workers"`
+	PieceOrder       []string                   `json:"piece-order" yaml:"piece-order" toml:"piece-order" mapstructure:"piece-order"`
+	Stats            map[string]ConfigStat      `json:"stats" yaml:"stats" toml:"stats" mapstructure:"stats"`
+	Attributes       map[string]ConfigAttribute `json:"attributes" yaml:"attributes" toml:"attributes" mapstructure:"attributes"`
+	Rarity           ConfigRarity               `json:"rarity" yaml:"rarity" toml:"rarity" mapstructure:"rarity"`
+	MaxWorkers       float64                    `json:"max-workers" yaml:"max-workers" toml:"max-workers" mapstructure:"max-workers"`
+	Seed             *int64                     `json:"seed,omitempty" yaml:"seed,omitempty" toml:"seed,omitempty" mapstructure:"seed"`
+	PieceCacheMB     int                        `json:"piece-cache-mb" yaml:"piece-cache-mb" toml:"piece-cache-mb" mapstructure:"piece-cache-mb"`
+	CompositeCacheMB int                        `json:"composite-cache-mb" yaml:"composite-cache-mb" toml:"composite-cache-mb" mapstructure:"composite-cache-mb"`
 }
 
 type ConfigDescriptions struct {
@@ -86,11 +184,40 @@ type PieceAttribute struct {
 	Rarity       string         `json:"rarity" yaml:"rarity" toml:"rarity" mapstructure:"rarity"`
 	Stats        map[string]int `json:"stats" yaml:"stats" toml:"stats" mapstructure:"stats"`
 	FriendlyName string         `json:"friendly-name" yaml:"friendly-name" toml:"friendly-name" mapstructure:"friendly-name"`
+	MaxSupply    int            `json:"max-supply" yaml:"max-supply" toml:"max-supply" mapstructure:"max-supply"`
+	ExactSupply  int            `json:"exact-supply" yaml:"exact-supply" toml:"exact-supply" mapstructure:"exact-supply"`
+	Weight       float64        `json:"weight" yaml:"weight" toml:"weight" mapstructure:"weight"`
+}
+
+// Pieces are referenced in rules as "attribute/piece", e.g. "hat/crown"
+type ConfigRules struct {
+	Exclusions   []ConfigExclusionRule   `json:"exclusions" yaml:"exclusions" toml:"exclusions" mapstructure:"exclusions"`
+	Requirements []ConfigRequirementRule `json:"requirements" yaml:"requirements" toml:"requirements" mapstructure:"requirements"`
+	Empty        []ConfigEmptyRule       `json:"empty" yaml:"empty" toml:"empty" mapstructure:"empty"`
+}
+
+type ConfigExclusionRule struct {
+	Piece    string   `json:"piece" yaml:"piece" toml:"piece" mapstructure:"piece"`
+	Excludes []string `json:"excludes" yaml:"excludes" toml:"excludes" mapstructure:"excludes"`
+}
+
+type ConfigRequirementRule struct {
+	Piece    string   `json:"piece" yaml:"piece" toml:"piece" mapstructure:"piece"`
+	Requires []string `json:"requires" yaml:"requires" toml:"requires" mapstructure:"requires"`
+}
+
+type ConfigEmptyRule struct {
+	Attribute string `json:"attribute" yaml:"attribute" toml:"attribute" mapstructure:"attribute"`
+	When      string `json:"when" yaml:"when" toml:"when" mapstructure:"when"`
 }
 
 type ConfigPiece struct {
-	FriendlyName string                    `json:"friendly-name" yaml:"friendly-name" toml:"friendly-name" mapstructure:"friendly-name"`
-	Pieces       map[string]PieceAttribute `json:"pieces" yaml:"pieces" toml:"pieces" mapstructure:"pieces"`
+	FriendlyName     string                    `json:"friendly-name" yaml:"friendly-name" toml:"friendly-name" mapstructure:"friendly-name"`
+	Pieces           map[string]PieceAttribute `json:"pieces" yaml:"pieces" toml:"pieces" mapstructure:"pieces"`
+	IgnoreUniqueness bool                      `json:"ignore-uniqueness" yaml:"ignore-uniqueness" toml:"ignore-uniqueness" mapstructure:"ignore-uniqueness"`
+	Rarity           ConfigRarity              `json:"rarity" yaml:"rarity" toml:"rarity" mapstructure:"rarity"`
+	EmptyChance      float64                   `json:"empty-chance" yaml:"empty-chance" toml:"empty-chance" mapstructure:"empty-chance"`
+	EmptyValue       string                    `json:"empty-value" yaml:"empty-value" toml:"empty-value" mapstructure:"empty-value"`
 }
 
 func LoadConfig(path string) (Config, error) {
@@ -0,0 +1,165 @@
+package generator
+
+import (
+	"container/list"
+	"context"
+	"image"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// pieceCache holds decoded pieces shared by every worker. When maxBytes is set the
+// least recently used pieces are evicted once the decoded pixels exceed it
+type pieceCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	entries  map[pieceRef]*cacheEntry
+	lru      *list.List
+	decode   func(path string) (*image.RGBA, error)
+}
+
+type cacheEntry struct {
+	img   *image.RGBA
+	err   error
+	size  int64
+	ready chan struct{}
+	elem  *list.Element
+}
+
+func newPieceCache(maxBytes int64) *pieceCache {
+	return &pieceCache{
+		maxBytes: maxBytes,
+		entries:  make(map[pieceRef]*cacheEntry),
+		lru:      list.New(),
+		decode:   decodePiece,
+	}
+}
+
+// get returns the decoded piece, decoding it from path on a miss. Concurrent misses
+// for the same piece wait for a single decode
+func (c *pieceCache) get(ref pieceRef, path string) (*image.RGBA, error) {
+	c.mu.Lock()
+	if entry, ok := c.entries[ref]; ok {
+		if entry.elem != nil {
+			c.lru.MoveToFront(entry.elem)
+		}
+		c.mu.Unlock()
+		<-entry.ready
+		return entry.img, entry.err
+	}
+	entry := &cacheEntry{ready: make(chan struct{})}
+	c.entries[ref] = entry
+	c.mu.Unlock()
+
+	entry.img, entry.err = c.decode(path)
+
+	c.mu.Lock()
+	if entry.err != nil {
+		delete(c.entries, ref)
+	} else {
+		entry.size = int64(len(entry.img.Pix))
+		entry.elem = c.lru.PushFront(ref)
+		c.size += entry.size
+		c.evict()
+	}
+	c.mu.Unlock()
+	close(entry.ready)
+	return entry.img, entry.err
+}
+
+// evict drops the least recently used pieces until the cache fits, always keeping the newest piece
+func (c *pieceCache) evict() {
+	for c.maxBytes > 0 && c.size > c.maxBytes && c.lru.Len() > 1 {
+		oldest := c.lru.Back()
+		ref := c.lru.Remove(oldest).(pieceRef)
+		c.size -= c.entries[ref].size
+		delete(c.entries, ref)
+	}
+}
+
+func (c *pieceCache) full() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.maxBytes > 0 && c.size >= c.maxBytes
+}
+
+// preload decodes the pieces used by the plans before rendering, most used first,
+// until every piece is loaded or the cache is full
+func (c *pieceCache) preload(ctx context.Context, plans []tokenPlan, pathOf func(ref pieceRef) string, workers int) error {
+	startTime := time.Now()
+	usage := make(map[pieceRef]int)
+	for _, plan := range plans {
+		for attribute, piece := range plan.selection {
+			if piece != emptyPiece {
+				usage[pieceRef{attribute: attribute, piece: piece}]++
+			}
+		}
+	}
+	refs := make([]pieceRef, 0, len(usage))
+	for ref := range usage {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if usage[refs[i]] != usage[refs[j]] {
+			return usage[refs[i]] > usage[refs[j]]
+		}
+		return refs[i].String() < refs[j].String()
+	})
+
+	if workers < 1 {
+		workers = 1
+	}
+	queue := make(chan pieceRef)
+	errChan := make(chan error, workers)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for ref := range queue {
+				if _, err := c.get(ref, pathOf(ref)); err != nil {
+					errChan <- err
+					return
+				}
+			}
+		}()
+	}
+
+	var err error
+	loaded := 0
+feed:
+	for _, ref := range refs {
+		if c.full() {
+			break
+		}
+		select {
+		case queue <- ref:
+			loaded++
+		case err = <-errChan:
+			break feed
+		case <-ctx.Done():
+			err = ctx.Err()
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+	if err == nil {
+		select {
+		case err = <-errChan:
+		default:
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	size := c.size
+	c.mu.Unlock()
+	log.Printf("Preloaded %d of %d pieces (%.1f MB) in %d ms\n", loaded, len(refs), float64(size)/(1<<20), time.Since(startTime).Milliseconds())
+	return nil
+}
@@ -0,0 +1,98 @@
+package generator
+
+import (
+	"context"
+	"image"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingCache returns a cache of 8x8 pieces, 256 bytes each, that counts the decodes of every path
+func countingCache(maxBytes int64) (*pieceCache, map[string]int) {
+	cache := newPieceCache(maxBytes)
+	decodes := make(map[string]int)
+	var mu sync.Mutex
+	cache.decode = func(path string) (*image.RGBA, error) {
+		mu.Lock()
+		decodes[path]++
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		return image.NewRGBA(image.Rect(0, 0, 8, 8)), nil
+	}
+	return cache, decodes
+}
+
+func TestPieceCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache, decodes := countingCache(512)
+	refs := []pieceRef{{"background", "dark"}, {"background", "blue"}, {"hat", "cap"}}
+	get := func(ref pieceRef) {
+		if _, err := cache.get(ref, ref.String()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	get(refs[0])
+	get(refs[1])
+	get(refs[0])
+	get(refs[2])
+	if cache.size != 512 || len(cache.entries) != 2 {
+		t.Errorf("cache holds %d pieces in %d bytes, want 2 in 512", len(cache.entries), cache.size)
+	}
+	if _, ok := cache.entries[refs[1]]; ok {
+		t.Errorf("%s was used least recently and should be evicted", refs[1])
+	}
+
+	get(refs[0])
+	get(refs[1])
+	if decodes[refs[0].String()] != 1 || decodes[refs[1].String()] != 2 {
+		t.Errorf("decodes %v, only the evicted piece should be decoded again", decodes)
+	}
+}
+
+func TestPieceCacheDecodesOnceForConcurrentRequests(t *testing.T) {
+	cache, decodes := countingCache(0)
+	ref := pieceRef{"hat", "crown"}
+	images := make([]*image.RGBA, 8)
+	var wg sync.WaitGroup
+	for i := range images {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			img, err := cache.get(ref, "crown.png")
+			if err != nil {
+				t.Error(err)
+			}
+			images[i] = img
+		}(i)
+	}
+	wg.Wait()
+	if decodes["crown.png"] != 1 {
+		t.Errorf("decoded %d times, want once", decodes["crown.png"])
+	}
+	for _, img := range images {
+		if img != images[0] {
+			t.Fatal("concurrent requests got different images")
+		}
+	}
+}
+
+func TestPreloadStopsWhenCacheIsFull(t *testing.T) {
+	cache, decodes := countingCache(512)
+	plans := []tokenPlan{
+		{id: 0, selection: map[string]string{"background": "dark", "hat": "cap"}},
+		{id: 1, selection: map[string]string{"background": "dark", "hat": "crown"}},
+		{id: 2, selection: map[string]string{"background": "green", "hat": emptyPiece}},
+		{id: 3, selection: map[string]string{"background": "blue", "hat": "cap"}},
+	}
+	err := cache.preload(context.Background(), plans, func(ref pieceRef) string { return ref.String() }, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// with one worker the cache is found full at the latest once the third piece is decoded
+	if len(decodes) > 3 {
+		t.Errorf("preloaded %d of 5 pieces into a cache of 2", len(decodes))
+	}
+	if cache.size > 512 {
+		t.Errorf("cache holds %d bytes, more than its 512", cache.size)
+	}
+}
@@ -0,0 +1,125 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+// cip25Limit is the maximum length in bytes of a string in Cardano transaction metadata
+const cip25Limit = 64
+
+// cip25Filename holds the metadata of every token of a cip25 run
+const cip25Filename = "meta.json"
+
+// CIP25Asset is the CIP-25 metadata of a single asset. Strings longer than 64 bytes are split
+// into an array of chunks as the standard requires
+type CIP25Asset struct {
+	Name        string                 `json:"name"`
+	Image       interface{}            `json:"image"`
+	MediaType   string                 `json:"mediaType"`
+	Description interface{}            `json:"description,omitempty"`
+	Files       []CIP25File            `json:"files"`
+	Attributes  map[string]interface{} `json:"attributes"`
+}
+
+type CIP25File struct {
+	Name      string      `json:"name"`
+	MediaType string      `json:"mediaType"`
+	Src       interface{} `json:"src"`
+}
+
+func cip25AssetName(output conf.OutputObject, i int) string {
+	return fmt.Sprintf("%s%d", output.Cardano.AssetPrefix, i)
+}
+
+// cip25Meta converts the metadata of a token to a CIP-25 asset
+func cip25Meta(meta OpenSeaMeta, output conf.OutputObject) CIP25Asset {
+	out := CIP25Asset{
+		Name:       meta.Name,
+		Image:      chunkString(meta.Image),
+		MediaType:  imageMimeType(output),
+		Files:      []CIP25File{{Name: meta.Name, MediaType: imageMimeType(output), Src: chunkString(meta.Image)}},
+		Attributes: make(map[string]interface{}, len(meta.Attributes)),
+	}
+	if meta.Description != "" {
+		out.Description = chunkString(meta.Description)
+	}
+	for _, attribute := range meta.Attributes {
+		value := attribute.Value
+		if text, ok := value.(string); ok {
+			value = chunkString(text)
+		}
+		out.Attributes[attribute.TraitType] = value
+	}
+	return out
+}
+
+// cip25Key is a trait name written as an attribute key along with the config path setting it
+type cip25Key struct {
+	path string
+	name string
+}
+
+// longCIP25Keys returns the trait names longer than a metadata string. Unlike values, attribute keys
+// cannot be split into chunks
+func longCIP25Keys(config *conf.Config) []cip25Key {
+	var keys []cip25Key
+	for _, key := range sortedKeys(config.Attributes) {
+		keys = append(keys, cip25Key{fmt.Sprintf("$.attributes.%s.friendly-name", key), attributeName(config, key)})
+	}
+	for _, key := range sortedKeys(config.Settings.Stats) {
+		keys = append(keys, cip25Key{fmt.Sprintf("$.settings.stats.%s.name", key), statName(config, key)})
+	}
+	for _, key := range sortedKeys(config.Settings.Attributes) {
+		name := config.Settings.Attributes[key].Name
+		if name == "" {
+			name = key
+		}
+		keys = append(keys, cip25Key{fmt.Sprintf("$.settings.attributes.%s.name", key), name})
+	}
+	long := keys[:0]
+	for _, key := range keys {
+		if len(key.name) > cip25Limit {
+			long = append(long, key)
+		}
+	}
+	return long
+}
+
+// chunkString returns s, or s split into chunks of at most 64 bytes on rune boundaries when it is longer
+func chunkString(s string) interface{} {
+	if len(s) <= cip25Limit {
+		return s
+	}
+	var chunks []string
+	for len(s) > cip25Limit {
+		end := cip25Limit
+		for end > 0 && !utf8.RuneStart(s[end]) {
+			end--
+		}
+		chunks = append(chunks, s[:end])
+		s = s[end:]
+	}
+	return append(chunks, s)
+}
+
+// storeCIP25 writes the assets of the run as a single policy-keyed metadata document to meta.json
+// and returns the document
+func storeCIP25(config *conf.Config, assets map[string]json.RawMessage) ([]byte, error) {
+	document := map[string]interface{}{
+		"721": map[string]interface{}{
+			config.Output.Cardano.PolicyID: assets,
+			"version":                      "1.0",
+		},
+	}
+	data, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return data, os.WriteFile(filepath.Join(config.Output.Local.Directory, cip25Filename), data, 0666)
+}
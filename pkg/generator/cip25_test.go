@@ -0,0 +1,81 @@
+package generator
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+func TestChunkString(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want []string
+	}{
+		{"empty", "", []string{""}},
+		{"at the limit", strings.Repeat("a", 64), []string{strings.Repeat("a", 64)}},
+		{"over the limit", strings.Repeat("a", 130), []string{strings.Repeat("a", 64), strings.Repeat("a", 64), "aa"}},
+		// é is two bytes and would straddle the first chunk
+		{"rune boundary", strings.Repeat("a", 63) + "éb", []string{strings.Repeat("a", 63), "éb"}},
+	}
+	for _, test := range tests {
+		var got []string
+		switch chunks := chunkString(test.s).(type) {
+		case string:
+			got = []string{chunks}
+		case []string:
+			got = chunks
+		}
+		if strings.Join(got, "|") != strings.Join(test.want, "|") {
+			t.Errorf("%s: chunks %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCIP25Meta(t *testing.T) {
+	output := conf.OutputObject{MetaFormat: conf.CIP25}
+	image := "ipfs://" + strings.Repeat("c", 60) + "/7.png"
+	meta := OpenSeaMeta{
+		Name:        "7",
+		Image:       image,
+		Description: "short",
+		Attributes:  []OpenSeaAttribute{{TraitType: "Headwear", Value: "Crown"}, {TraitType: "Wit", Value: 3, DisplayType: "number"}},
+	}
+	data, err := json.Marshal(cip25Meta(meta, output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks := `["` + image[:64] + `","` + image[64:] + `"]`
+	want := `{"name":"7","image":` + chunks + `,"mediaType":"image/png","description":"short",` +
+		`"files":[{"name":"7","mediaType":"image/png","src":` + chunks + `}],"attributes":{"Headwear":"Crown","Wit":3}}`
+	if string(data) != want {
+		t.Errorf("cip25 asset\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestLongCIP25KeysAreRejected(t *testing.T) {
+	config := testConfig(3)
+	config.Output.IncludeMeta = true
+	config.Output.MetaFormat = conf.CIP25
+	config.Output.Local.Directory = "out"
+	config.Output.Cardano.PolicyID = strings.Repeat("ab", 28)
+	if _, err := New(config); err != nil {
+		t.Fatalf("unexpected error with short keys: %s", err)
+	}
+
+	long := strings.Repeat("x", 65)
+	config.Settings.Stats = map[string]conf.ConfigStat{"wit": {Name: long}}
+	if paths := outputProblems(config); len(paths) != 1 || paths[0] != "$.settings.stats.wit.name" {
+		t.Errorf("problems at %v, want $.settings.stats.wit.name", paths)
+	}
+	if _, err := New(config); err == nil {
+		t.Error("expected New to reject a stat name longer than 64 bytes")
+	}
+	config.Settings.Stats = nil
+	config.Attributes["hat"] = conf.ConfigPiece{FriendlyName: long, Pieces: config.Attributes["hat"].Pieces}
+	if paths := outputProblems(config); len(paths) != 1 || paths[0] != "$.attributes.hat.friendly-name" {
+		t.Errorf("problems at %v, want $.attributes.hat.friendly-name", paths)
+	}
+}
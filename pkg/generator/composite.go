@@ -0,0 +1,139 @@
+package generator
+
+import (
+	"container/list"
+	"image"
+	"strings"
+	"sync"
+
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+const defaultCompositeCacheMB = 256
+
+// compositeCache holds partially layered images keyed by the pieces drawn so far, so tokens
+// sharing their lower layers start from the deepest shared composite. Only prefixes used by
+// more than one token are cached and each is dropped once its last token is done
+type compositeCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	entries  map[string]*list.Element
+	lru      *list.List
+	uses     map[string]int
+}
+
+type compositeEntry struct {
+	key string
+	img *image.RGBA
+}
+
+// newCompositeCache returns nil, disabling the cache, when maxMB is negative
+func newCompositeCache(config *conf.Config, plans []tokenPlan, maxMB int) *compositeCache {
+	if maxMB < 0 {
+		return nil
+	}
+	if maxMB == 0 {
+		maxMB = defaultCompositeCacheMB
+	}
+	uses := make(map[string]int)
+	for _, plan := range plans {
+		keys := prefixKeys(planLayers(config, plan.selection))
+		for depth := 0; depth < len(keys)-1; depth++ {
+			uses[keys[depth]]++
+		}
+	}
+	return &compositeCache{
+		maxBytes: int64(maxMB) << 20,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		uses:     uses,
+	}
+}
+
+// planLayers returns the pieces drawn for a selection in piece order
+func planLayers(config *conf.Config, selection map[string]string) []pieceRef {
+	layers := make([]pieceRef, 0, len(config.Settings.PieceOrder))
+	for _, attribute := range config.Settings.PieceOrder {
+		if piece := selection[attribute]; piece != emptyPiece {
+			layers = append(layers, pieceRef{attribute: attribute, piece: piece})
+		}
+	}
+	return layers
+}
+
+// prefixKeys returns the key of every prefix of the layers, keys[i] covering layers[0] to layers[i]
+func prefixKeys(layers []pieceRef) []string {
+	keys := make([]string, len(layers))
+	var key strings.Builder
+	for i, layer := range layers {
+		if i > 0 {
+			key.WriteString("|")
+		}
+		key.WriteString(layer.String())
+		keys[i] = key.String()
+	}
+	return keys
+}
+
+// lookup returns the number of layers covered by the deepest cached prefix and its composite
+func (c *compositeCache) lookup(keys []string) (int, *image.RGBA) {
+	if c == nil {
+		return 0, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for depth := len(keys) - 1; depth >= 0; depth-- {
+		if elem, ok := c.entries[keys[depth]]; ok {
+			c.lru.MoveToFront(elem)
+			return depth + 1, elem.Value.(*compositeEntry).img
+		}
+	}
+	return 0, nil
+}
+
+// store keeps a copy of the composite when other tokens still need the prefix
+func (c *compositeCache) store(key string, img *image.RGBA) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; ok || c.uses[key] < 2 {
+		return
+	}
+	size := int64(len(img.Pix))
+	if size > c.maxBytes {
+		return
+	}
+	clone := image.NewRGBA(img.Rect)
+	copy(clone.Pix, img.Pix)
+	c.entries[key] = c.lru.PushFront(&compositeEntry{key: key, img: clone})
+	c.size += size
+	for c.size > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+// release marks the prefixes of a finished token as used, dropping composites nobody needs anymore
+func (c *compositeCache) release(keys []string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for depth := 0; depth < len(keys)-1; depth++ {
+		c.uses[keys[depth]]--
+		if c.uses[keys[depth]] <= 0 {
+			if elem, ok := c.entries[keys[depth]]; ok {
+				c.remove(elem)
+			}
+		}
+	}
+}
+
+func (c *compositeCache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*compositeEntry)
+	c.size -= int64(len(entry.img.Pix))
+	delete(c.entries, entry.key)
+}
@@ -0,0 +1,116 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"testing"
+
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+func TestCompositeCacheReleasesAndEvicts(t *testing.T) {
+	config := testConfig(6)
+	plans := []tokenPlan{
+		{id: 0, selection: map[string]string{"background": "dark", "hat": "cap"}},
+		{id: 1, selection: map[string]string{"background": "dark", "hat": "crown"}},
+		{id: 2, selection: map[string]string{"background": "green", "hat": "cap"}},
+		{id: 3, selection: map[string]string{"background": "green", "hat": "crown"}},
+		{id: 4, selection: map[string]string{"background": "blue", "hat": "cap"}},
+		{id: 5, selection: map[string]string{"background": "blue", "hat": "crown"}},
+	}
+	keys := make([][]string, len(plans))
+	for i, plan := range plans {
+		keys[i] = prefixKeys(planLayers(config, plan.selection))
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	img.Pix[0] = 7
+
+	cache := newCompositeCache(config, plans, 1)
+	cache.store(keys[0][0], img)
+	if depth, composite := cache.lookup(keys[1]); depth != 1 || composite == nil || composite.Pix[0] != 7 {
+		t.Errorf("lookup of the shared background found depth %d", depth)
+	}
+	img.Pix[0] = 8
+	if _, composite := cache.lookup(keys[1]); composite.Pix[0] != 7 {
+		t.Error("the cache keeps the composite of the caller instead of a copy")
+	}
+	cache.release(keys[0])
+	if depth, _ := cache.lookup(keys[1]); depth != 1 {
+		t.Error("composite dropped while token 1 still needs it")
+	}
+	cache.release(keys[1])
+	if depth, _ := cache.lookup(keys[1]); depth != 0 || cache.size != 0 {
+		t.Errorf("composite kept after its last token, %d bytes cached", cache.size)
+	}
+
+	// room for two composites, the least recently used goes first
+	cache = newCompositeCache(config, plans, 1)
+	cache.maxBytes = 2 * int64(len(img.Pix))
+	cache.store(keys[0][0], img)
+	cache.store(keys[2][0], img)
+	cache.lookup(keys[1])
+	cache.store(keys[4][0], img)
+	for i, want := range []int{1, 0, 1} {
+		if depth, _ := cache.lookup(keys[2*i+1]); depth != want {
+			t.Errorf("token %d starts from depth %d, want %d", 2*i+1, depth, want)
+		}
+	}
+	if len(cache.entries) != 2 || cache.size != cache.maxBytes {
+		t.Errorf("%d composites in %d bytes, want 2 in %d", len(cache.entries), cache.size, cache.maxBytes)
+	}
+	// only prefixes shared by several tokens are cached
+	cache.store(keys[5][1], img)
+	if _, ok := cache.entries[keys[5][1]]; ok {
+		t.Error("the complete image of token 5 was cached")
+	}
+}
+
+func TestNegativeCompositeCacheDisablesIt(t *testing.T) {
+	config := testConfig(1)
+	plans := []tokenPlan{{selection: map[string]string{"background": "dark", "hat": "cap"}}}
+	cache := newCompositeCache(config, plans, -1)
+	if cache != nil {
+		t.Fatal("negative size should disable the cache")
+	}
+	keys := prefixKeys(planLayers(config, plans[0].selection))
+	cache.store(keys[0], image.NewRGBA(image.Rect(0, 0, 1, 1)))
+	if depth, composite := cache.lookup(keys); depth != 0 || composite != nil {
+		t.Error("disabled cache returned a composite")
+	}
+	cache.release(keys)
+}
+
+func TestCompositeCacheKeepsImagesIdentical(t *testing.T) {
+	var outputs [][]byte
+	for _, size := range []int{-1, 0} {
+		config := renderConfig(t, 18)
+		config.Settings.PieceOrder = append(config.Settings.PieceOrder, "cape")
+		config.Attributes["cape"] = conf.ConfigPiece{Pieces: map[string]conf.PieceAttribute{
+			"red":  {Rarity: "common"},
+			"gold": {Rarity: "rare"},
+		}}
+		writePiece(t, piecePath(config, "cape", "red"), 3, 200)
+		writePiece(t, piecePath(config, "cape", "gold"), 5, 230)
+		seed := int64(3)
+		config.Settings.Seed = &seed
+		config.Settings.CompositeCacheMB = size
+		config.Output = conf.OutputObject{}
+		g, err := New(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assets, err := g.Generate(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var images []byte
+		for _, asset := range assets {
+			images = append(images, asset.Image.Bytes()...)
+		}
+		outputs = append(outputs, images)
+	}
+	if !bytes.Equal(outputs[0], outputs[1]) {
+		t.Error("images differ with the composite cache enabled")
+	}
+}
@@ -0,0 +1,198 @@
+package generator
+
+import (
+	"bytes"
+	CSV "encoding/csv"
+	"fmt"
+	"html/template"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+// Cooccurrence counts how often every two pieces of different attributes appear on the same token
+type Cooccurrence struct {
+	Tokens int
+	Pairs  []AttributePair
+}
+
+// AttributePair is the co-occurrence matrix of two attributes, rows are the pieces of the first
+// attribute and columns the pieces of the second. RowTotals and ColumnTotals count the tokens
+// having each piece. Lift is how much more often two pieces appear together than if they were
+// picked independently, 1 being independent and 0 when either piece never appears
+type AttributePair struct {
+	First        string
+	Second       string
+	Rows         []string
+	Columns      []string
+	RowTotals    []int
+	ColumnTotals []int
+	Counts       [][]int
+	Lift         [][]float64
+}
+
+// BuildCooccurrence computes the co-occurrence matrix of every pair of attributes in piece order.
+// Attributes and pieces are listed by their names in the metadata, every piece of the config is
+// included even when the collection never uses it
+func BuildCooccurrence(config *conf.Config, manifest *Manifest) (*Cooccurrence, error) {
+	count := len(manifest.Tokens)
+	if count == 0 {
+		return nil, fmt.Errorf("the manifest lists no tokens")
+	}
+	order := config.Settings.PieceOrder
+	selections := make([]map[string]string, count)
+	totals := make(map[string]map[string]int, len(order))
+	for _, attribute := range order {
+		totals[attribute] = make(map[string]int)
+	}
+	for t, token := range manifest.Tokens {
+		selections[t] = make(map[string]string, len(order))
+		for _, attribute := range order {
+			piece, ok := token.Selection[attribute]
+			if !ok {
+				piece = emptyPiece
+			}
+			selections[t][attribute] = piece
+			totals[attribute][piece]++
+		}
+	}
+
+	result := &Cooccurrence{Tokens: count}
+	for i, first := range order {
+		for _, second := range order[i+1:] {
+			pair := AttributePair{
+				First:  attributeName(config, first),
+				Second: attributeName(config, second),
+			}
+			rows, columns := attributePieces(config, first, totals[first]), attributePieces(config, second, totals[second])
+			for _, row := range rows {
+				pair.Rows = append(pair.Rows, pieceName(config, first, row))
+				pair.RowTotals = append(pair.RowTotals, totals[first][row])
+			}
+			for _, column := range columns {
+				pair.Columns = append(pair.Columns, pieceName(config, second, column))
+				pair.ColumnTotals = append(pair.ColumnTotals, totals[second][column])
+			}
+			together := make(map[[2]string]int)
+			for _, selection := range selections {
+				together[[2]string{selection[first], selection[second]}]++
+			}
+			for _, row := range rows {
+				counts := make([]int, len(columns))
+				lift := make([]float64, len(columns))
+				for c, column := range columns {
+					counts[c] = together[[2]string{row, column}]
+					if expected := totals[first][row] * totals[second][column]; expected > 0 {
+						lift[c] = float64(counts[c]) * float64(count) / float64(expected)
+					}
+				}
+				pair.Counts = append(pair.Counts, counts)
+				pair.Lift = append(pair.Lift, lift)
+			}
+			result.Pairs = append(result.Pairs, pair)
+		}
+	}
+	return result, nil
+}
+
+// attributePieces returns the keys of every piece of an attribute sorted, followed by the empty
+// piece when the attribute can be left empty or is empty on any token
+func attributePieces(config *conf.Config, attribute string, totals map[string]int) []string {
+	pieces := make([]string, 0, len(config.Attributes[attribute].Pieces)+1)
+	for key := range config.Attributes[attribute].Pieces {
+		pieces = append(pieces, key)
+	}
+	sort.Strings(pieces)
+	empty := totals[emptyPiece] > 0 || config.Attributes[attribute].EmptyChance > 0
+	for _, rule := range config.Rules.Empty {
+		empty = empty || rule.Attribute == attribute
+	}
+	if empty {
+		pieces = append(pieces, emptyPiece)
+	}
+	return pieces
+}
+
+// CSV lists every pair of pieces on its own row
+func (c *Cooccurrence) CSV() ([]byte, error) {
+	var out bytes.Buffer
+	w := CSV.NewWriter(&out)
+	w.Write([]string{"Attribute", "Piece", "Other Attribute", "Other Piece", "Count", "Lift"})
+	for _, pair := range c.Pairs {
+		for r, row := range pair.Rows {
+			for col, column := range pair.Columns {
+				w.Write([]string{
+					pair.First,
+					row,
+					pair.Second,
+					column,
+					strconv.Itoa(pair.Counts[r][col]),
+					strconv.FormatFloat(pair.Lift[r][col], 'f', 4, 64),
+				})
+			}
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("error writing csv: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// heatColor shades a lift red when pieces appear together more often than chance and blue when
+// less often, at full strength from four times or a quarter as often
+func heatColor(lift float64) string {
+	shade := math.Log2(lift) / 2
+	if shade > 1 || math.IsInf(shade, 1) {
+		shade = 1
+	}
+	if shade < -1 || math.IsInf(shade, -1) {
+		shade = -1
+	}
+	fade := int(math.Round(255 * (1 - math.Abs(shade))))
+	if shade > 0 {
+		return fmt.Sprintf("#ff%02x%02x", fade, fade)
+	}
+	return fmt.Sprintf("#%02x%02xff", fade, fade)
+}
+
+var cooccurrenceTemplate = template.Must(template.New("cooccurrence").Funcs(template.FuncMap{
+	"heat": heatColor,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Trait co-occurrence</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 80em; color: #222; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { padding: 0.25em 0.75em; border: 1px solid #ddd; }
+td { text-align: right; }
+th { text-align: left; }
+</style>
+</head>
+<body>
+<h1>Trait co-occurrence</h1>
+<p>Lift of every two pieces across {{.Tokens}} tokens, how much more often they appear together than if they were picked independently. Red cells appear together more often, blue cells less often, pieces that never appear are marked -. Hover a cell for its count.</p>
+{{range $pair := .Pairs}}
+<h2>{{$pair.First}} and {{$pair.Second}}</h2>
+<table>
+<tr><th>{{$pair.First}} \ {{$pair.Second}}</th>{{range $pair.Columns}}<th>{{.}}</th>{{end}}</tr>
+{{range $r, $row := $pair.Rows}}<tr><th>{{$row}}</th>{{range $c, $column := $pair.Columns}}{{if and (index $pair.RowTotals $r) (index $pair.ColumnTotals $c)}}{{$lift := index $pair.Lift $r $c}}<td style="background: {{heat $lift}}" title="{{$row}} and {{$column}}: {{index $pair.Counts $r $c}} tokens">{{printf "%.2f" $lift}}</td>{{else}}<td title="{{$row}} or {{$column}} never appears">-</td>{{end}}{{end}}</tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
+
+// HTML renders the lift of every pair of attributes as a self-contained heatmap page
+func (c *Cooccurrence) HTML() (string, error) {
+	var out strings.Builder
+	if err := cooccurrenceTemplate.Execute(&out, c); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,49 @@
+package generator
+
+import "testing"
+
+func TestBuildCooccurrenceListsEveryPieceByName(t *testing.T) {
+	config := testConfig(4)
+	manifest := &Manifest{Tokens: []ManifestToken{
+		{Selection: map[string]string{"background": "dark", "hat": "cap"}},
+		{Selection: map[string]string{"background": "dark", "hat": "cap"}},
+		{Selection: map[string]string{"background": "blue", "hat": "crown"}},
+		{Selection: map[string]string{"background": "blue"}},
+	}}
+	cooccurrence, err := BuildCooccurrence(config, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cooccurrence.Pairs) != 1 {
+		t.Fatalf("%d pairs of attributes, want 1", len(cooccurrence.Pairs))
+	}
+	pair := cooccurrence.Pairs[0]
+	if pair.First != "Background" || pair.Second != "Headwear" {
+		t.Errorf("pair of %q and %q", pair.First, pair.Second)
+	}
+	wantRows := []string{"Blue", "Dark", "Green"}
+	wantColumns := []string{"Baseball Cap", "Crown", "None"}
+	if len(pair.Rows) != len(wantRows) || len(pair.Columns) != len(wantColumns) {
+		t.Fatalf("rows %v and columns %v, want %v and %v", pair.Rows, pair.Columns, wantRows, wantColumns)
+	}
+	for i := range wantRows {
+		if pair.Rows[i] != wantRows[i] || pair.Columns[i] != wantColumns[i] {
+			t.Errorf("rows %v and columns %v, want %v and %v", pair.Rows, pair.Columns, wantRows, wantColumns)
+		}
+	}
+	// dark always goes with a cap: 2 of 4 tokens against 2/4 * 2/4 expected
+	if lift := pair.Lift[1][0]; lift != 2 {
+		t.Errorf("lift of dark and cap %f, want 2", lift)
+	}
+	for c := range pair.Columns {
+		if pair.Counts[2][c] != 0 || pair.Lift[2][c] != 0 {
+			t.Errorf("unused green has count %d and lift %f with %s", pair.Counts[2][c], pair.Lift[2][c], pair.Columns[c])
+		}
+	}
+	if pair.RowTotals[2] != 0 || pair.ColumnTotals[2] != 1 {
+		t.Errorf("row totals %v, column totals %v", pair.RowTotals, pair.ColumnTotals)
+	}
+	if _, err := cooccurrence.HTML(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,148 @@
+package generator
+
+import (
+	CSV "encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+// csvTable collects the csv rows of a single run. Columns are fixed before the run: name, description
+// and image, then the attributes in piece order, the stats, the custom attributes and the rarity rank
+type csvTable struct {
+	mu      sync.Mutex
+	columns []string
+	index   map[string]int
+	rows    map[int][]string
+}
+
+// writesCSV reports if meta.csv is written, either as the meta format or alongside it
+func writesCSV(output conf.OutputObject) bool {
+	return output.IncludeMeta && (output.MetaFormat == conf.CSV || output.CSV)
+}
+
+// newCsvTable returns nil when no csv is written, a nil table ignores rows
+func newCsvTable(config *conf.Config) *csvTable {
+	if !writesCSV(config.Output) {
+		return nil
+	}
+	t := &csvTable{index: make(map[string]int), rows: make(map[int][]string)}
+	for _, column := range []string{"Name", "Description", "Image"} {
+		t.addColumn(column)
+	}
+	for _, attribute := range config.Settings.PieceOrder {
+		t.addColumn(attributeName(config, attribute))
+	}
+	stats := make([]string, 0, len(config.Settings.Stats))
+	for key := range config.Settings.Stats {
+		stats = append(stats, statName(config, key))
+	}
+	sort.Strings(stats)
+	for _, stat := range stats {
+		t.addColumn(stat)
+	}
+	keys := make([]string, 0, len(config.Settings.Attributes))
+	for key := range config.Settings.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		name := config.Settings.Attributes[key].Name
+		if name == "" {
+			name = key
+		}
+		t.addColumn(name)
+	}
+	t.addColumn("Type")
+	if config.Output.RarityRank.Inject && config.Output.RarityRank.Method != "" {
+		t.addColumn("Rarity Rank")
+		t.addColumn("Rarity Score")
+	}
+	return t
+}
+
+func (t *csvTable) addColumn(name string) {
+	if _, ok := t.index[name]; ok {
+		return
+	}
+	t.index[name] = len(t.columns)
+	t.columns = append(t.columns, name)
+}
+
+// addRow stores the row of a token, every column is present so values never shift
+func (t *csvTable) addRow(id int, meta OpenSeaMeta) {
+	if t == nil {
+		return
+	}
+	row := make([]string, len(t.columns))
+	row[t.index["Name"]] = meta.Name
+	row[t.index["Description"]] = meta.Description
+	row[t.index["Image"]] = meta.Image
+	for _, attribute := range meta.Attributes {
+		if column, ok := t.index[attribute.TraitType]; ok {
+			row[column] = csvValue(attribute.Value)
+		}
+	}
+	t.mu.Lock()
+	t.rows[id] = row
+	t.mu.Unlock()
+}
+
+// csvValue formats numbers without exponents and keeps zero values
+func csvValue(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(value), 'f', -1, 32)
+	case json.Number:
+		return value.String()
+	}
+	return fmt.Sprint(value)
+}
+
+// sortedRows returns the heading and the rows ordered by token id so output does not depend on worker scheduling
+func (t *csvTable) sortedRows() [][]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ids := make([]int, 0, len(t.rows))
+	for id := range t.rows {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	rows := [][]string{t.columns}
+	for _, id := range ids {
+		rows = append(rows, t.rows[id])
+	}
+	return rows
+}
+
+// write stores the table as meta.csv in the output directory
+func (t *csvTable) write(dir string) error {
+	if t == nil || dir == "" {
+		return nil
+	}
+	metaFile, err := os.Create(filepath.Join(dir, "meta.csv"))
+	if err != nil {
+		return err
+	}
+	w := CSV.NewWriter(metaFile)
+	err = w.WriteAll(t.sortedRows())
+	if closeErr := metaFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing csv: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package generator
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+func TestCSVColumnsAndZeroValues(t *testing.T) {
+	config := renderConfig(t, 9)
+	config.Output.CSV = true
+	config.Settings.Stats = map[string]conf.ConfigStat{
+		"wit":        {Name: "Wit", Maximum: 10},
+		"grit":       {Maximum: 10},
+		"lucky_draw": {Maximum: 10},
+	}
+	config.Settings.Attributes = map[string]conf.ConfigAttribute{
+		"edition": {Name: "Edition", Value: "First"},
+		"artist":  {Value: "Ann"},
+	}
+	config.Attributes["hat"].Pieces["crown"] = conf.PieceAttribute{Rarity: "rare", Stats: map[string]int{"wit": 2, "grit": 1}}
+	g, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Generate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(filepath.Join(config.Output.Local.Directory, "meta.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"Name", "Description", "Image", "Background", "Headwear", "Grit", "Lucky Draw", "Wit", "artist", "Edition", "Type"}
+	if !reflect.DeepEqual(rows[0], want) {
+		t.Fatalf("columns %q, want %q", rows[0], want)
+	}
+	if len(rows) != 10 {
+		t.Fatalf("%d rows, want a heading and a row per token", len(rows))
+	}
+	for id, row := range rows[1:] {
+		if row[0] != fmt.Sprint(id) {
+			t.Errorf("row %d is token %s", id, row[0])
+		}
+		wit, grit := "0", "0"
+		if row[4] == "Crown" {
+			wit, grit = "2", "1"
+		}
+		if row[5] != grit || row[6] != "0" || row[7] != wit {
+			t.Errorf("token %d with %s has stats %q, want grit %s, lucky draw 0 and wit %s", id, row[4], row[5:8], grit, wit)
+		}
+		if row[8] != "Ann" || row[9] != "First" {
+			t.Errorf("token %d: custom attributes %q", id, row[8:10])
+		}
+	}
+}
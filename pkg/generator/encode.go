@@ -0,0 +1,266 @@
+package generator
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	conf "github.com/clickpop/looks/pkg/config"
+	"github.com/clickpop/looks/pkg/webp"
+)
+
+const defaultJPEGQuality = 90
+
+// defaultJPEGBackground is the color translucent pixels are flattened onto, jpeg has no alpha channel
+var defaultJPEGBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+
+func imageFormat(output conf.OutputObject) conf.ImageFormat {
+	if output.ImageFormat == "" {
+		return conf.PNG
+	}
+	return output.ImageFormat
+}
+
+// imageExtension returns the file extension of the configured image format
+func imageExtension(output conf.OutputObject) string {
+	switch imageFormat(output) {
+	case conf.JPEG:
+		return "jpg"
+	case conf.GIF:
+		return "gif"
+	case conf.WebP:
+		return "webp"
+	}
+	return "png"
+}
+
+// imageFilename returns the name of the image file of a token
+func imageFilename(output conf.OutputObject, i int) string {
+	return fmt.Sprintf("%d.%s", i, imageExtension(output))
+}
+
+func pngCompression(level string) (png.CompressionLevel, error) {
+	switch level {
+	case "", "default":
+		return png.DefaultCompression, nil
+	case "none":
+		return png.NoCompression, nil
+	case "best-speed":
+		return png.BestSpeed, nil
+	case "best-compression":
+		return png.BestCompression, nil
+	}
+	return png.DefaultCompression, fmt.Errorf("unknown png compression %q", level)
+}
+
+// jpegBackground parses a #rrggbb color, white when unset
+func jpegBackground(hex string) (color.RGBA, error) {
+	if hex == "" {
+		return defaultJPEGBackground, nil
+	}
+	value, err := strconv.ParseUint(strings.TrimPrefix(hex, "#"), 16, 32)
+	if err != nil || len(hex) != 7 || hex[0] != '#' {
+		return color.RGBA{}, fmt.Errorf("invalid color %q, expected #rrggbb", hex)
+	}
+	return color.RGBA{uint8(value >> 16), uint8(value >> 8), uint8(value), 0xff}, nil
+}
+
+// flatten composites img onto an opaque background
+func flatten(img *image.RGBA, background color.RGBA) *image.RGBA {
+	flat := image.NewRGBA(img.Bounds())
+	draw.Draw(flat, flat.Bounds(), &image.Uniform{background}, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+	return flat
+}
+
+func paletteSize(colors int) int {
+	if colors <= 0 || colors > 256 {
+		return 256
+	}
+	return colors
+}
+
+// encodeImage writes img in the configured image format
+func encodeImage(w io.Writer, img *image.RGBA, output conf.OutputObject) error {
+	switch imageFormat(output) {
+	case conf.PNG:
+		level, err := pngCompression(output.PNGCompression)
+		if err != nil {
+			return err
+		}
+		encoder := png.Encoder{CompressionLevel: level}
+		if output.PNGPalette {
+			return encoder.Encode(w, palettedImage(img, 256))
+		}
+		return encoder.Encode(w, img)
+	case conf.JPEG:
+		quality := output.JPEGQuality
+		if quality <= 0 {
+			quality = defaultJPEGQuality
+		}
+		background, err := jpegBackground(output.JPEGBackground)
+		if err != nil {
+			return err
+		}
+		return jpeg.Encode(w, flatten(img, background), &jpeg.Options{Quality: quality})
+	case conf.GIF:
+		return gif.Encode(w, palettedImage(img, paletteSize(output.GIFColors)), nil)
+	case conf.WebP:
+		return webp.Encode(w, img)
+	}
+	return fmt.Errorf("unsupported image format %q", output.ImageFormat)
+}
+
+// palettedImage maps img to an adaptive palette of at most colors colors
+func palettedImage(img *image.RGBA, colors int) *image.Paletted {
+	paletted := image.NewPaletted(img.Bounds(), quantize(img, colors))
+	draw.Draw(paletted, paletted.Bounds(), img, img.Bounds().Min, draw.Src)
+	return paletted
+}
+
+type colorCount struct {
+	c     color.RGBA
+	count int
+}
+
+// colorBox is a set of colors of the median cut, along with its widest channel
+type colorBox struct {
+	colors  []colorCount
+	channel int
+	span    int
+}
+
+func newColorBox(colors []colorCount) colorBox {
+	box := colorBox{colors: colors}
+	if len(colors) < 2 {
+		return box
+	}
+	for ch := 0; ch < 4; ch++ {
+		low, high := 255, 0
+		for _, cc := range colors {
+			v := channelValue(cc.c, ch)
+			if v < low {
+				low = v
+			}
+			if v > high {
+				high = v
+			}
+		}
+		if high-low > box.span {
+			box.channel, box.span = ch, high-low
+		}
+	}
+	return box
+}
+
+// quantize builds a palette of at most n colors for img using median cut. The range of every box
+// is computed once, when the box is created, so each split only scans the box being split
+func quantize(img *image.RGBA, n int) color.Palette {
+	histogram := make(map[color.RGBA]int)
+	for i := 0; i+3 < len(img.Pix); i += 4 {
+		histogram[color.RGBA{img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3]}]++
+	}
+	colors := make([]colorCount, 0, len(histogram))
+	for c, count := range histogram {
+		colors = append(colors, colorCount{c: c, count: count})
+	}
+	sort.Slice(colors, func(i, j int) bool {
+		a, b := colors[i].c, colors[j].c
+		if a.R != b.R {
+			return a.R < b.R
+		}
+		if a.G != b.G {
+			return a.G < b.G
+		}
+		if a.B != b.B {
+			return a.B < b.B
+		}
+		return a.A < b.A
+	})
+
+	boxes := []colorBox{newColorBox(colors)}
+	for len(boxes) < n {
+		widest := -1
+		for i, box := range boxes {
+			if box.span > 0 && (widest < 0 || box.span > boxes[widest].span) {
+				widest = i
+			}
+		}
+		if widest < 0 {
+			break
+		}
+		box := boxes[widest].colors
+		sortByChannel(box, boxes[widest].channel)
+		total := 0
+		for _, cc := range box {
+			total += cc.count
+		}
+		split, seen := 1, 0
+		for i, cc := range box[:len(box)-1] {
+			seen += cc.count
+			if seen*2 >= total {
+				split = i + 1
+				break
+			}
+		}
+		boxes[widest] = newColorBox(box[:split])
+		boxes = append(boxes, colorBox{})
+		copy(boxes[widest+2:], boxes[widest+1:])
+		boxes[widest+1] = newColorBox(box[split:])
+	}
+
+	palette := make(color.Palette, 0, len(boxes))
+	for _, box := range boxes {
+		var r, g, b, a, total int
+		for _, cc := range box.colors {
+			r += int(cc.c.R) * cc.count
+			g += int(cc.c.G) * cc.count
+			b += int(cc.c.B) * cc.count
+			a += int(cc.c.A) * cc.count
+			total += cc.count
+		}
+		if total == 0 {
+			continue
+		}
+		palette = append(palette, color.RGBA{uint8(r / total), uint8(g / total), uint8(b / total), uint8(a / total)})
+	}
+	return palette
+}
+
+// sortByChannel orders colors by one channel with a stable counting sort
+func sortByChannel(colors []colorCount, channel int) {
+	var offsets [257]int
+	for _, cc := range colors {
+		offsets[channelValue(cc.c, channel)+1]++
+	}
+	for i := 1; i < len(offsets); i++ {
+		offsets[i] += offsets[i-1]
+	}
+	sorted := make([]colorCount, len(colors))
+	for _, cc := range colors {
+		v := channelValue(cc.c, channel)
+		sorted[offsets[v]] = cc
+		offsets[v]++
+	}
+	copy(colors, sorted)
+}
+
+func channelValue(c color.RGBA, channel int) int {
+	switch channel {
+	case 0:
+		return int(c.R)
+	case 1:
+		return int(c.G)
+	case 2:
+		return int(c.B)
+	}
+	return int(c.A)
+}
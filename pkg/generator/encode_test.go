@@ -0,0 +1,58 @@
+package generator
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestJPEGBackground(t *testing.T) {
+	tests := []struct {
+		hex  string
+		want color.RGBA
+		ok   bool
+	}{
+		{"", color.RGBA{0xff, 0xff, 0xff, 0xff}, true},
+		{"#102030", color.RGBA{0x10, 0x20, 0x30, 0xff}, true},
+		{"102030", color.RGBA{}, false},
+		{"#1020", color.RGBA{}, false},
+		{"#10203g", color.RGBA{}, false},
+	}
+	for _, test := range tests {
+		got, err := jpegBackground(test.hex)
+		if (err == nil) != test.ok || got != test.want {
+			t.Errorf("jpegBackground(%q) = %v, %v", test.hex, got, err)
+		}
+	}
+}
+
+func TestFlattenCompositesOntoBackground(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.SetRGBA(1, 0, color.RGBA{0x80, 0, 0, 0x80})
+	flat := flatten(img, color.RGBA{0, 0, 0xff, 0xff})
+	if got := flat.RGBAAt(0, 0); got != (color.RGBA{0, 0, 0xff, 0xff}) {
+		t.Errorf("transparent pixel flattened to %v", got)
+	}
+	if got := flat.RGBAAt(1, 0); got != (color.RGBA{0x80, 0, 0x7f, 0xff}) {
+		t.Errorf("translucent pixel flattened to %v", got)
+	}
+}
+
+func TestQuantizeSplitsWidestBoxes(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 1))
+	colors := []color.RGBA{{0, 0, 0, 0xff}, {10, 0, 0, 0xff}, {0, 200, 0, 0xff}, {0, 210, 0, 0xff}}
+	for x, c := range colors {
+		img.SetRGBA(x, 0, c)
+	}
+	if palette := quantize(img, 4); len(palette) != 4 {
+		t.Errorf("got %d colors for 4 distinct colors", len(palette))
+	}
+	palette := quantize(img, 2)
+	if len(palette) != 2 {
+		t.Fatalf("got %d colors, want 2", len(palette))
+	}
+	// green is the widest channel, so the dark colors and the green ones end up in separate boxes
+	if palette[0] != (color.RGBA{5, 0, 0, 0xff}) || palette[1] != (color.RGBA{0, 205, 0, 0xff}) {
+		t.Errorf("unexpected palette %v", palette)
+	}
+}
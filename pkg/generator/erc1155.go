@@ -0,0 +1,49 @@
+package generator
+
+import (
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+// ERC1155Meta is the metadata JSON schema of EIP-1155
+type ERC1155Meta struct {
+	Name         string                 `json:"name"`
+	Description  string                 `json:"description,omitempty"`
+	Image        string                 `json:"image"`
+	ExternalURL  string                 `json:"external_url,omitempty"`
+	Attributes   []OpenSeaAttribute     `json:"attributes,omitempty"`
+	Properties   map[string]interface{} `json:"properties,omitempty"`
+	Localization *ERC1155Localization   `json:"localization,omitempty"`
+}
+
+type ERC1155Localization struct {
+	URI     string   `json:"uri"`
+	Default string   `json:"default"`
+	Locales []string `json:"locales"`
+}
+
+// erc1155Meta converts the metadata of a token to EIP-1155, with the traits as attributes or as properties
+func erc1155Meta(meta OpenSeaMeta, output conf.OutputObject) ERC1155Meta {
+	settings := output.ERC1155
+	out := ERC1155Meta{
+		Name:        meta.Name,
+		Description: meta.Description,
+		Image:       meta.Image,
+		ExternalURL: meta.ExternalURL,
+	}
+	if settings.Properties {
+		out.Properties = make(map[string]interface{}, len(meta.Attributes))
+		for _, attribute := range meta.Attributes {
+			out.Properties[attribute.TraitType] = attribute.Value
+		}
+	} else {
+		out.Attributes = meta.Attributes
+	}
+	if settings.Localization.URI != "" {
+		out.Localization = &ERC1155Localization{
+			URI:     settings.Localization.URI,
+			Default: settings.Localization.Default,
+			Locales: settings.Localization.Locales,
+		}
+	}
+	return out
+}
@@ -0,0 +1,55 @@
+package generator
+
+import (
+	"encoding/json"
+	"testing"
+
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+func TestERC1155Meta(t *testing.T) {
+	meta := OpenSeaMeta{
+		Name:       "26",
+		Image:      "ipfs://dir/26.png",
+		Attributes: []OpenSeaAttribute{{TraitType: "Headwear", Value: "Crown"}, {TraitType: "Wit", Value: 3, DisplayType: "number"}},
+	}
+	localization := conf.ERC1155Localization{URI: "ipfs://locales/{locale}/{id}.json", Default: "en", Locales: []string{"en", "fr"}}
+	tests := []struct {
+		name   string
+		output conf.OutputERC1155
+		want   string
+	}{
+		{"attributes", conf.OutputERC1155{},
+			`{"name":"26","image":"ipfs://dir/26.png","attributes":[{"trait_type":"Headwear","value":"Crown"},{"trait_type":"Wit","display_type":"number","value":3}]}`},
+		{"properties", conf.OutputERC1155{Properties: true, Localization: localization},
+			`{"name":"26","image":"ipfs://dir/26.png","properties":{"Headwear":"Crown","Wit":3},` +
+				`"localization":{"uri":"ipfs://locales/{locale}/{id}.json","default":"en","locales":["en","fr"]}}`},
+	}
+	for _, test := range tests {
+		output := conf.OutputObject{MetaFormat: conf.ERC1155, ERC1155: test.output}
+		data, err := json.Marshal(erc1155Meta(meta, output))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != test.want {
+			t.Errorf("%s:\n%s\nwant\n%s", test.name, data, test.want)
+		}
+	}
+}
+
+func TestERC1155Filenames(t *testing.T) {
+	output := conf.OutputObject{MetaFormat: conf.ERC1155}
+	name := metaFilename(output, 26)
+	if name != "000000000000000000000000000000000000000000000000000000000000001a.json" {
+		t.Errorf("metadata file %s", name)
+	}
+	if id, ok := metaFileID(output, name); !ok || id != 26 {
+		t.Errorf("metaFileID(%s) = %d, %t", name, id, ok)
+	}
+	if _, ok := metaFileID(output, "26.json"); ok {
+		t.Error("a decimal name is not an erc1155 metadata file")
+	}
+	if image := imageFilename(output, 26); image != "26.png" {
+		t.Errorf("image file %s, images keep decimal names", image)
+	}
+}
@@ -1,48 +1,81 @@
 package generator
 
 import (
-	"bytes"
 	"fmt"
-	"os"
+	"image"
 
 	"github.com/clickpop/looks/internal/utils"
 	conf "github.com/clickpop/looks/pkg/config"
 )
 
-func loadFiles(config *conf.Config) ([]*bytes.Reader, Metadata, error) {
+// piecePath returns the location of the image of a piece based on the input settings
+func piecePath(config *conf.Config, attribute string, piece string) string {
+	filename := fmt.Sprintf(config.Input.Local.Filename, attribute, piece)
+	return fmt.Sprintf("%s/%s", config.Input.Local.Pathname, filename)
+}
+
+// attributeName returns the trait type of an attribute in the metadata
+func attributeName(config *conf.Config, attribute string) string {
+	if name := config.Attributes[attribute].FriendlyName; name != "" {
+		return name
+	}
+	return utils.TransformName(attribute)
+}
+
+// statName returns the trait type of a stat in the metadata
+func statName(config *conf.Config, key string) string {
+	if name := config.Settings.Stats[key].Name; name != "" {
+		return name
+	}
+	return utils.TransformName(key)
+}
+
+// emptyName names an empty attribute without an empty-value
+const emptyName = "(empty)"
+
+// pieceName returns the trait value of a piece in the metadata. Empty attributes are named by their
+// empty-value, or emptyName when they have none
+func pieceName(config *conf.Config, attribute string, key string) string {
+	if key == emptyPiece {
+		if value := config.Attributes[attribute].EmptyValue; value != "" {
+			return value
+		}
+		return emptyName
+	}
+	if name := config.Attributes[attribute].Pieces[key].FriendlyName; name != "" {
+		return name
+	}
+	return utils.TransformName(key)
+}
+
+// loadFiles returns the decoded layers of a selection in piece order, along with their metadata
+func loadFiles(cache *pieceCache, config *conf.Config, selection map[string]string, probabilities map[string]map[string]float64) ([]*image.RGBA, Metadata, error) {
 	fileNames := config.Settings.PieceOrder
-	var files []*bytes.Reader
+	var files []*image.RGBA
 	var metadata Metadata
 	for i := 0; i < len(fileNames); i++ {
 		file := fileNames[i]
-		pieceTypeFriendlyName := config.Attributes[file].FriendlyName
-		if pieceTypeFriendlyName == "" {
-			pieceTypeFriendlyName = utils.TransformName(file)
-		}
-		piece, meta := handleRarity(config.Attributes[file].Pieces, config.Settings.Rarity, config.Output)
+		pieceTypeFriendlyName := attributeName(config, file)
+		piece := selection[file]
+		meta := config.Attributes[file].Pieces[piece]
 
-		if piece != "nil" {
-			pieceFriendlyName := config.Attributes[file].Pieces[piece].FriendlyName
-			if pieceFriendlyName == "" {
-				pieceFriendlyName = utils.TransformName(piece)
-			}
-			filename := fmt.Sprintf(config.Input.Local.Filename, file, piece)
-			data, err := os.ReadFile(fmt.Sprintf("%s/%s", config.Input.Local.Pathname, filename))
+		if piece != emptyPiece {
+			pieceFriendlyName := pieceName(config, file, piece)
+			img, err := cache.get(pieceRef{attribute: file, piece: piece}, piecePath(config, file, piece))
 			if err != nil {
 				return nil, Metadata{}, err
 			}
-			files = append(files, bytes.NewReader(data))
+			files = append(files, img)
 			stats := make(map[string]conf.ConfigStat)
 			for k, v := range meta.Stats {
 				stat := config.Settings.Stats[k]
-				name := stat.Name
-				if name == "" {
-					name = utils.TransformName(k)
-				}
+				stat.Name = statName(config, k)
 				stat.Value = v
 				stats[k] = stat
 			}
-			metadata.PieceMeta = append(metadata.PieceMeta, PieceMetadata{Type: pieceTypeFriendlyName, Piece: pieceFriendlyName, Attributes: stats, Rarity: meta.Rarity, FriendlyName: meta.FriendlyName})
+			metadata.PieceMeta = append(metadata.PieceMeta, PieceMetadata{Type: pieceTypeFriendlyName, Piece: pieceFriendlyName, Attributes: stats, Rarity: meta.Rarity, FriendlyName: meta.FriendlyName, Probability: probabilities[file][piece]})
+		} else if emptyValue := config.Attributes[file].EmptyValue; emptyValue != "" {
+			metadata.PieceMeta = append(metadata.PieceMeta, PieceMetadata{Type: pieceTypeFriendlyName, Piece: emptyValue, Probability: probabilities[file][piece]})
 		}
 	}
 
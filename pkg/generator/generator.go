@@ -2,28 +2,27 @@ package generator
 
 import (
 	"bytes"
-	CSV "encoding/csv"
+	"context"
+	"encoding/json"
 	"fmt"
-	"image"
-	"image/png"
 	"log"
 	"os"
-	"regexp"
-	"strconv"
+	"path/filepath"
+	"reflect"
 	"sync"
 	"time"
 
 	conf "github.com/clickpop/looks/pkg/config"
+	"github.com/clickpop/looks/pkg/ipfs"
 )
 
-var wg sync.WaitGroup
-
 type PieceMetadata struct {
 	Piece        string
 	Type         string
 	Attributes   map[string]conf.ConfigStat
 	Rarity       string
 	FriendlyName string
+	Probability  float64
 }
 
 type Metadata struct {
@@ -48,160 +47,450 @@ type OpenSeaAttribute struct {
 	DisplayType string      `json:"display_type,omitempty"`
 	Value       interface{} `json:"value,omitempty"`
 	MaxValue    int         `json:"max_value,omitempty"`
+	Probability float64     `json:"probability,omitempty"`
 }
 type GeneratedRat struct {
 	Image *bytes.Buffer
 	Meta  *bytes.Buffer
 }
 
-type Job struct {
-	id      int
-	results chan GeneratedRat
-	errors  chan error
-	currImg *image.RGBA
-	outFile *os.File
+// Generator builds a collection from a config. The config is deep copied when the generator is created
+// so the caller's config is never modified, nor are later changes to it seen by the generator
+type Generator struct {
+	config conf.Config
+	rules  *ruleSet
+	cache  *pieceCache
 }
 
-func Generate(config *conf.Config, hashCheckCb func(config *conf.Config)) ([]GeneratedRat, error) {
-	startTime := time.Now()
-	buildCsvHeading(config)
-	log.Println(csv)
-	outputDir := config.Output.Local.Directory
-	if (config.Output == conf.OutputObject{}) {
-		config.Output.Internal = true
+// New prepares a generator for the supplied config, failing early on invalid rules
+func New(config *conf.Config) (*Generator, error) {
+	g := &Generator{config: copyConfig(config)}
+	if reflect.DeepEqual(g.config.Output, conf.OutputObject{}) {
+		g.config.Output.Internal = true
 	}
-
-	_, err := os.Stat(outputDir)
-	if os.IsNotExist(err) {
-		os.Mkdir(outputDir, 0777)
-	} else if err != nil {
+	if g.config.Output.EmbedMeta && imageFormat(g.config.Output) != conf.PNG {
+		return nil, fmt.Errorf("metadata can only be embedded in png images, image format is %s", g.config.Output.ImageFormat)
+	}
+	if g.config.Output.EmbedMeta && !g.config.Output.IncludeMeta {
+		return nil, fmt.Errorf("embedding metadata requires include-meta")
+	}
+	switch g.config.Output.RarityRank.Method {
+	case "", conf.StatisticalRarity, conf.RarityScore:
+	default:
+		return nil, fmt.Errorf("unsupported rarity method %q, supported methods are statistical and rarity-score", g.config.Output.RarityRank.Method)
+	}
+	if g.config.Output.IncludeMeta && g.config.Output.MetaFormat == conf.CIP25 {
+		if keys := longCIP25Keys(&g.config); len(keys) > 0 {
+			return nil, fmt.Errorf("%s: cip25 attribute keys can be at most %d bytes, %q is %d", keys[0].path, cip25Limit, keys[0].name, len(keys[0].name))
+		}
+	}
+	if g.config.Output.CARFile != "" && g.config.Output.Local.Directory == "" {
+		return nil, fmt.Errorf("a car file can only be written along with an output directory")
+	}
+	for _, key := range sortedKeys(g.config.Settings.Attributes) {
+		if err := checkTimestamp(g.config.Settings.Attributes[key]); err != nil {
+			return nil, fmt.Errorf("settings.attributes.%s: %w", key, err)
+		}
+	}
+	rules, err := compileRules(&g.config)
+	if err != nil {
 		return nil, err
 	}
+	g.rules = rules
+	g.cache = newPieceCache(int64(g.config.Settings.PieceCacheMB) << 20)
+	return g, nil
+}
 
-	image_count := int(config.Output.ImageCount)
+// copyConfig returns a copy of the config sharing no maps or pointers with it
+func copyConfig(config *conf.Config) conf.Config {
+	copied := *config
+	if config.Attributes != nil {
+		copied.Attributes = make(map[string]conf.ConfigPiece, len(config.Attributes))
+		for key, attribute := range config.Attributes {
+			attribute.Rarity.Chances = copyInts(attribute.Rarity.Chances)
+			pieces := attribute.Pieces
+			if pieces != nil {
+				attribute.Pieces = make(map[string]conf.PieceAttribute, len(pieces))
+				for name, piece := range pieces {
+					piece.Stats = copyInts(piece.Stats)
+					attribute.Pieces[name] = piece
+				}
+			}
+			copied.Attributes[key] = attribute
+		}
+	}
+	if config.Settings.Stats != nil {
+		copied.Settings.Stats = make(map[string]conf.ConfigStat, len(config.Settings.Stats))
+		for key, stat := range config.Settings.Stats {
+			copied.Settings.Stats[key] = stat
+		}
+	}
+	if config.Settings.Attributes != nil {
+		copied.Settings.Attributes = make(map[string]conf.ConfigAttribute, len(config.Settings.Attributes))
+		for key, attribute := range config.Settings.Attributes {
+			copied.Settings.Attributes[key] = attribute
+		}
+	}
+	copied.Settings.Rarity.Chances = copyInts(config.Settings.Rarity.Chances)
+	if config.Settings.Seed != nil {
+		seed := *config.Settings.Seed
+		copied.Settings.Seed = &seed
+	}
+	if config.Descriptions.StatFragments != nil {
+		copied.Descriptions.StatFragments = make(map[string]conf.ConfigDescriptionTypes, len(config.Descriptions.StatFragments))
+		for key, fragment := range config.Descriptions.StatFragments {
+			copied.Descriptions.StatFragments[key] = fragment
+		}
+	}
+	return copied
+}
 
-	wg.Add(image_count)
+// copyInts copies a map of rarity chances or stat values
+func copyInts(chances map[string]int) map[string]int {
+	if chances == nil {
+		return nil
+	}
+	copied := make(map[string]int, len(chances))
+	for key, chance := range chances {
+		copied[key] = chance
+	}
+	return copied
+}
 
-	jobs := make(chan int, image_count)
-	results := make(chan GeneratedRat, image_count)
-	errChan := make(chan error)
+// Generate builds a collection with a background context, see Generator.Generate
+func Generate(config *conf.Config) ([]GeneratedRat, error) {
+	g, err := New(config)
+	if err != nil {
+		return nil, err
+	}
+	return g.Generate(context.Background())
+}
 
-	num_workers := config.Settings.MaxWorkers
+// Generate builds every image and its metadata. The first error stops all workers and is returned,
+// as is the context error when ctx is cancelled before the collection is done
+func (g *Generator) Generate(ctx context.Context) ([]GeneratedRat, error) {
+	config := &g.config
+	startTime := time.Now()
+	table := newCsvTable(config)
+	outputDir := config.Output.Local.Directory
 
-	log.Printf("Spinning up %d workers", int(num_workers))
-	for w := 0; w < int(num_workers); w++ {
-		go handleJob(config, jobs, results, errChan)
-	}
-	for i := 0; i < image_count; i++ {
-		jobs <- i
+	image_count := int(config.Output.ImageCount)
+
+	if combinations := countUniqueCombinations(config, g.rules, image_count); combinations < image_count {
+		return nil, fmt.Errorf("only %d unique combinations of pieces are available, %d images were requested", combinations, image_count)
 	}
-	close(jobs)
 
-	var assets []GeneratedRat
-	for r := range results {
-		assets = append(assets, r)
+	seed := collectionSeed(config)
+	log.Printf("Using seed %d", seed)
+
+	// the output directory is only created once every token could be planned
+	plans, err := planTokens(config, g.rules, seed, image_count)
+	if err != nil {
+		return nil, err
 	}
-	wg.Wait()
-	if config.Output.MetaFormat == conf.CSV {
-		metaFile, err := os.Create(fmt.Sprintf("%s/meta.csv", config.Output.Local.Directory))
+
+	if outputDir != "" {
+		_, err := os.Stat(outputDir)
+		if os.IsNotExist(err) {
+			err = os.Mkdir(outputDir, 0777)
+		}
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
-		defer metaFile.Close()
-		w := CSV.NewWriter(metaFile)
-		err = w.WriteAll(csv)
+	}
+
+	err = g.cache.preload(ctx, plans, func(ref pieceRef) string {
+		return piecePath(config, ref.attribute, ref.piece)
+	}, int(config.Settings.MaxWorkers))
+	if err != nil {
+		return nil, err
+	}
+
+	var probabilities map[string]map[string]float64
+	if config.Output.IncludeMeta && config.Output.Probability {
+		probabilities, _, err = plannedShares(config, image_count, seed)
 		if err != nil {
-			log.Fatal("Error writing csv:", err)
+			return nil, err
 		}
 	}
+
+	r := &run{
+		config:        config,
+		seed:          seed,
+		started:       seedTime(seed),
+		pieces:        g.cache,
+		composites:    newCompositeCache(config, plans, config.Settings.CompositeCacheMB),
+		table:         table,
+		probabilities: probabilities,
+		ranks:         rankTokens(config, plans),
+	}
+	tokens, err := g.render(ctx, r, plans)
+	if err != nil {
+		return nil, err
+	}
+	assets, err := writeMeta(r, tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := table.write(outputDir); err != nil {
+		return nil, err
+	}
 	log.Printf("Generated %d files in directory %s in %d seconds.\n", image_count, outputDir, int(time.Since(startTime).Seconds()))
-	if outputDir != "" && hashCheckCb == nil {
-		noCollisions := false
-		for !noCollisions {
-			collisions, err := checkHashes(outputDir)
-			if err != nil {
-				return nil, err
-			}
-			re := regexp.MustCompile(`^(.*/)?(?:$|(.+?)(?:(\.[^.]*$)|$))`)
-			for _, path := range collisions {
-				match := re.FindStringSubmatch(path)
-				if len(match) > 2 {
-					str := match[2]
-					val, err := strconv.Atoi(str)
-					if err != nil {
-						return nil, err
-					}
-					stats := buildStats(config)
-					asset, err := buildAsset(config, val, stats)
-					if err != nil {
-						return nil, err
-					}
-					assets = append(assets, asset)
-				}
+	return assets, nil
+}
+
+// run holds the state shared by the workers of a single Generate call
+type run struct {
+	config        *conf.Config
+	seed          int64
+	started       int64
+	pieces        *pieceCache
+	composites    *compositeCache
+	table         *csvTable
+	probabilities map[string]map[string]float64
+	// ranks holds the rarity rank of every token by id, nil unless output.rarity-rank is set
+	ranks []tokenRank
+}
+
+// rankedMeta adds the rarity rank and score to the metadata of token i when they are injected
+func (r *run) rankedMeta(meta OpenSeaMeta, i int) OpenSeaMeta {
+	if r.ranks != nil && r.config.Output.RarityRank.Inject {
+		meta.Attributes = append(append([]OpenSeaAttribute{}, meta.Attributes...), rankAttributes(r.ranks[i], len(r.ranks))...)
+	}
+	return meta
+}
+
+// renderedToken is a rendered image whose metadata is written once every image of the run is done
+type renderedToken struct {
+	image     []byte
+	meta      OpenSeaMeta
+	file      imageFile
+	dna       string
+	selection map[string]string
+}
+
+type renderResult struct {
+	id    int
+	token renderedToken
+	err   error
+}
+
+// render is the coordinator of a run. It owns the dispatcher feeding the plans to the workers,
+// the workers themselves and the collection of their results, and closes every channel it creates.
+// At most max-workers images are rendered at the same time
+func (g *Generator) render(parent context.Context, r *run, plans []tokenPlan) ([]renderedToken, error) {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	num_workers := int(g.config.Settings.MaxWorkers)
+	if num_workers < 1 {
+		num_workers = 1
+	}
+	if num_workers > len(plans) {
+		num_workers = len(plans)
+	}
+
+	jobs := make(chan tokenPlan)
+	results := make(chan renderResult)
+
+	go func() {
+		defer close(jobs)
+		for _, plan := range plans {
+			select {
+			case jobs <- plan:
+			case <-ctx.Done():
+				return
 			}
-			if len(collisions) < 1 {
-				noCollisions = true
+		}
+	}()
+
+	log.Printf("Spinning up %d workers", num_workers)
+	var wg sync.WaitGroup
+	wg.Add(num_workers)
+	for w := 0; w < num_workers; w++ {
+		go func() {
+			defer wg.Done()
+			handleJob(ctx, r, jobs, results)
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	tokens := make([]renderedToken, len(plans))
+	var firstErr error
+	for result := range results {
+		if result.err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("image #%d: %w", result.id, result.err)
+				cancel()
 			}
+			continue
 		}
+		tokens[result.id] = result.token
 	}
-	return assets, nil
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := parent.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
 }
 
-func handleJob(config *conf.Config, jobs <-chan int, results chan<- GeneratedRat, errChan chan<- error) {
-	stats := buildStats(config)
+// buildToken renders a single token, tests replace it to observe the workers
+var buildToken = buildAsset
+
+func handleJob(ctx context.Context, r *run, jobs <-chan tokenPlan, results chan<- renderResult) {
+	stats := buildStats(r.config)
 
 	for job := range jobs {
-		i := job
-		rat, err := buildAsset(config, i, stats)
-		if err != nil {
-			errChan <- err
+		if ctx.Err() != nil {
+			return
 		}
-		if results != nil {
-			results <- rat
+		token, err := buildToken(r, job, stats)
+		select {
+		case results <- renderResult{id: job.id, token: token, err: err}:
+		case <-ctx.Done():
+			return
 		}
-		wg.Done()
-		config.Output.ImageCount -= 1
-	}
-	if config.Output.ImageCount == 0 {
-		close(results)
-		close(errChan)
 	}
 }
 
-func buildAsset(config *conf.Config, jobId int, stats map[string]int) (GeneratedRat, error) {
-	i := jobId
+// buildAsset renders the image of a token and writes it to the output directory
+func buildAsset(r *run, plan tokenPlan, stats map[string]int) (renderedToken, error) {
+	config := r.config
+	i := plan.id
 	log.Printf("Loading files for image #%d\n", i)
-	files, metadata, err := loadFiles(config)
+	images, metadata, err := loadFiles(r.pieces, config, plan.selection, r.probabilities)
 	if err != nil {
-		return GeneratedRat{}, nil
+		return renderedToken{}, err
 	}
-	log.Printf("Decoding data for image #%d\n", i)
-	images, err := getImages(files)
+	if len(images) == 0 {
+		return renderedToken{}, fmt.Errorf("no pieces selected")
+	}
+	img := buildImage(r.composites, prefixKeys(planLayers(config, plan.selection)), images, i)
+	encoded := new(bytes.Buffer)
+	err = encodeImage(encoded, img, config.Output)
 	if err != nil {
-		return GeneratedRat{}, nil
+		return renderedToken{}, err
 	}
-	imageOut := new(bytes.Buffer)
-	metaOut := new(bytes.Buffer)
-	img := buildImage(images, i)
-	var meta []byte
+	token := renderedToken{image: encoded.Bytes(), dna: plan.dna, selection: plan.selection}
 	if config.Output.IncludeMeta {
-		meta, err = generateMeta(metadata, config, i)
+		token.meta = tokenMeta(plan.rng, metadata, config, i, r.started)
+		if config.Output.EmbedMeta {
+			texts, err := tokenText(r.rankedMeta(token.meta, i), r.seed)
+			if err != nil {
+				return renderedToken{}, err
+			}
+			token.image, err = embedPNGText(token.image, texts)
+			if err != nil {
+				return renderedToken{}, err
+			}
+		}
 	}
+	token.file, err = describeImage(config.Output, i, token.image)
 	if err != nil {
-		return GeneratedRat{}, nil
-	}
-	if config.Output.Internal {
-		png.Encode(imageOut, img)
-		metaOut.Write(meta)
-	} else {
-		imageOut = nil
-		metaOut = nil
+		return renderedToken{}, err
 	}
 	if config.Output.Local.Directory != "" {
-		err = storeFile(config, img, meta, i)
+		err = storeImage(config, token.image, i)
+		if err != nil {
+			return renderedToken{}, err
+		}
+	}
+	if !config.Output.Internal {
+		token.image = nil
+	}
+	return token, nil
+}
+
+// writeMeta encodes and stores the metadata of every token in id order, once the links
+// to the images of the whole run are known
+func writeMeta(r *run, tokens []renderedToken) ([]GeneratedRat, error) {
+	config := r.config
+	directory, err := imageDirectory(config.Output, tokens)
+	if err != nil {
+		return nil, err
+	}
+	assets := make([]GeneratedRat, len(tokens))
+	metaFiles := make([]ipfs.Link, 0, len(tokens))
+	cip25Assets := make(map[string]json.RawMessage)
+	var jsonLines bytes.Buffer
+	manifest := newManifest(config, r.seed, directory)
+	for i, token := range tokens {
+		finalMeta := r.rankedMeta(token.meta, i)
+		var meta []byte
+		if config.Output.IncludeMeta {
+			meta, err = generateMeta(finalMeta, config, r.table, i, token.file, directory)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if config.Output.MetaFormat == conf.CIP25 && meta != nil {
+			cip25Assets[cip25AssetName(config.Output, i)] = meta
+		}
+		if config.Output.MetaFormat == conf.JSONL && meta != nil {
+			jsonLines.Write(meta)
+			jsonLines.WriteString("\n")
+		}
+		manifest.add(config, i, token, meta)
+		if r.ranks != nil {
+			manifest.rank(r.ranks[i])
+		}
+		if config.Output.Local.Directory != "" && tokenMetaFiles(config.Output) {
+			err = storeMeta(config, meta, i)
+			if err != nil {
+				return nil, err
+			}
+			if ipfsEnabled(config.Output) {
+				link, err := ipfs.File(meta, nil)
+				if err != nil {
+					return nil, err
+				}
+				link.Name = metaFilename(config.Output, i)
+				metaFiles = append(metaFiles, link)
+			}
+		}
+		if config.Output.Internal {
+			assets[i] = GeneratedRat{Image: bytes.NewBuffer(token.image), Meta: bytes.NewBuffer(meta)}
+		}
+	}
+	if config.Output.Local.Directory != "" && len(cip25Assets) > 0 {
+		data, err := storeCIP25(config, cip25Assets)
 		if err != nil {
-			return GeneratedRat{}, nil
+			return nil, err
+		}
+		if ipfsEnabled(config.Output) {
+			link, err := ipfs.File(data, nil)
+			if err != nil {
+				return nil, err
+			}
+			link.Name = cip25Filename
+			metaFiles = append(metaFiles, link)
 		}
 	}
-	return GeneratedRat{Image: imageOut, Meta: metaOut}, nil
+	if config.Output.Local.Directory != "" && jsonLines.Len() > 0 {
+		err = os.WriteFile(filepath.Join(config.Output.Local.Directory, "meta.jsonl"), jsonLines.Bytes(), 0666)
+		if err != nil {
+			return nil, err
+		}
+	}
+	manifest.linkMeta(metaFiles)
+	if config.Output.Local.Directory != "" && manifest != nil {
+		err = manifest.write(filepath.Join(config.Output.Local.Directory, manifestFilename))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.Output.CARFile != "" {
+		err = writeCar(config, tokens, metaFiles)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return assets, nil
 }
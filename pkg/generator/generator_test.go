@@ -0,0 +1,232 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+// replaceBuildToken swaps the renderer of the workers until the test ends
+func replaceBuildToken(t *testing.T, build func(r *run, plan tokenPlan, stats map[string]int) (renderedToken, error)) {
+	original := buildToken
+	buildToken = build
+	t.Cleanup(func() { buildToken = original })
+}
+
+func TestGenerateReturnsFirstError(t *testing.T) {
+	config := renderConfig(t, 9)
+	config.Settings.MaxWorkers = 1
+	replaceBuildToken(t, func(r *run, plan tokenPlan, stats map[string]int) (renderedToken, error) {
+		if plan.id >= 3 {
+			return renderedToken{}, fmt.Errorf("failed on purpose")
+		}
+		return buildAsset(r, plan, stats)
+	})
+	g, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = g.Generate(context.Background())
+	if err == nil || err.Error() != "image #3: failed on purpose" {
+		t.Errorf("error %v, want the error of image #3", err)
+	}
+
+	// every worker failing at once still returns a single error
+	config.Settings.MaxWorkers = 4
+	g, err = New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = g.Generate(context.Background()); err == nil || !strings.HasSuffix(err.Error(), "failed on purpose") {
+		t.Errorf("error %v with 4 workers", err)
+	}
+}
+
+func TestGenerateStopsWhenCancelled(t *testing.T) {
+	config := renderConfig(t, 9)
+	config.Settings.MaxWorkers = 1
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	built := 0
+	replaceBuildToken(t, func(r *run, plan tokenPlan, stats map[string]int) (renderedToken, error) {
+		built++
+		if built == 2 {
+			cancel()
+		}
+		return buildAsset(r, plan, stats)
+	})
+	g, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Generate(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("error %v, want %v", err, context.Canceled)
+	}
+	if built != 2 {
+		t.Errorf("built %d tokens, the worker should stop once the context is cancelled", built)
+	}
+}
+
+func TestGeneratorKeepsCallerConfig(t *testing.T) {
+	config := renderConfig(t, 9)
+	seed := int64(5)
+	config.Settings.Seed = &seed
+	config.Settings.Stats = map[string]conf.ConfigStat{"wit": {Name: "Wit", Maximum: 10}}
+	config.Attributes["hat"].Pieces["crown"] = conf.PieceAttribute{Rarity: "rare", Stats: map[string]int{"wit": 3}}
+	config.Output = conf.OutputObject{}
+	before := copyConfig(config)
+
+	g, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Generate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*config, before) {
+		t.Errorf("config changed by the generator:\n%+v\nwant\n%+v", *config, before)
+	}
+
+	// changes to the caller's config after New are not seen by the generator
+	seed = 6
+	config.Settings.Stats["wit"] = conf.ConfigStat{Name: "Cunning"}
+	config.Attributes["hat"].Pieces["crown"].Stats["wit"] = 9
+	delete(config.Attributes["background"].Pieces, "blue")
+	if *g.config.Settings.Seed != 5 || g.config.Settings.Stats["wit"].Name != "Wit" ||
+		g.config.Attributes["hat"].Pieces["crown"].Stats["wit"] != 3 || len(g.config.Attributes["background"].Pieces) != 3 {
+		t.Errorf("the generator shares its config with the caller: %+v", g.config)
+	}
+}
+
+func TestConcurrentGenerateCalls(t *testing.T) {
+	generators := make([]*Generator, 2)
+	for i := range generators {
+		config := renderConfig(t, 9)
+		config.Settings.MaxWorkers = 3
+		g, err := New(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		generators[i] = g
+	}
+	errs := make(chan error, len(generators))
+	for _, g := range generators {
+		go func(g *Generator) {
+			_, err := g.Generate(context.Background())
+			errs <- err
+		}(g)
+	}
+	for range generators {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	for _, g := range generators {
+		files, err := os.ReadDir(g.config.Output.Local.Directory)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// an image and a json file per token
+		if len(files) != 18 {
+			t.Errorf("%d files in %s, want 18", len(files), g.config.Output.Local.Directory)
+		}
+	}
+}
+
+func TestMaxWorkersBoundsConcurrency(t *testing.T) {
+	tests := []struct {
+		workers float64
+		want    int
+	}{
+		{0, 1},
+		{1, 1},
+		{3, 3},
+		{20, 9},
+	}
+	for _, test := range tests {
+		var mu sync.Mutex
+		running, peak := 0, 0
+		replaceBuildToken(t, func(r *run, plan tokenPlan, stats map[string]int) (renderedToken, error) {
+			mu.Lock()
+			running++
+			if running > peak {
+				peak = running
+			}
+			mu.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return buildAsset(r, plan, stats)
+		})
+		config := renderConfig(t, 9)
+		config.Settings.MaxWorkers = test.workers
+		g, err := New(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := g.Generate(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if peak != test.want {
+			t.Errorf("%v max-workers: %d tokens rendered at once, want %d", test.workers, peak, test.want)
+		}
+	}
+}
+
+func TestSameSeedSameOutputRegardlessOfWorkers(t *testing.T) {
+	outputs := make([]map[string][]byte, 0, 2)
+	for _, workers := range []float64{1, 4} {
+		config := renderConfig(t, 9)
+		seed := int64(42)
+		config.Settings.Seed = &seed
+		config.Settings.MaxWorkers = workers
+		config.Settings.Attributes = map[string]conf.ConfigAttribute{"born": {Type: "timestamp"}}
+		config.Output.EmbedMeta = true
+		config.Output.CSV = true
+		g, err := New(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := g.Generate(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, readFiles(t, config.Output.Local.Directory))
+	}
+	if len(outputs[0]) != 19 {
+		t.Errorf("%d files written, want an image and a json file per token and the csv", len(outputs[0]))
+	}
+	for name, data := range outputs[0] {
+		if !bytes.Equal(data, outputs[1][name]) {
+			t.Errorf("%s differs between 1 and 4 workers", name)
+		}
+	}
+}
+
+// readFiles returns the contents of the files in a directory by name
+func readFiles(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte, len(entries))
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[entry.Name()] = data
+	}
+	return files
+}
@@ -0,0 +1,78 @@
+package generator
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+// testConfig returns a config of two attributes with common and rare pieces and no rules
+func testConfig(count int) *conf.Config {
+	config := &conf.Config{}
+	config.Output.ImageCount = float64(count)
+	config.Settings.PieceOrder = []string{"background", "hat"}
+	config.Settings.Rarity = conf.ConfigRarity{
+		Order:   []string{"common", "rare"},
+		Chances: map[string]int{"common": 80, "rare": 20},
+	}
+	config.Attributes = map[string]conf.ConfigPiece{
+		"background": {Pieces: map[string]conf.PieceAttribute{
+			"dark":  {Rarity: "common"},
+			"green": {Rarity: "common"},
+			"blue":  {Rarity: "rare"},
+		}},
+		"hat": {FriendlyName: "Headwear", EmptyChance: 0.25, EmptyValue: "None", Pieces: map[string]conf.PieceAttribute{
+			"cap":   {Rarity: "common", FriendlyName: "Baseball Cap"},
+			"crown": {Rarity: "rare"},
+		}},
+	}
+	return config
+}
+
+// renderConfig returns testConfig with a png of every piece in a temporary input directory
+// and the images and metadata written to a temporary output directory
+func renderConfig(t *testing.T, count int) *conf.Config {
+	t.Helper()
+	config := testConfig(count)
+	config.Input.Local.Pathname = t.TempDir()
+	config.Input.Local.Filename = "%s-%s.png"
+	config.Output.Local.Directory = filepath.Join(t.TempDir(), "out")
+	config.Output.IncludeMeta = true
+	config.Output.MetaFormat = conf.JSON
+	shade := 0
+	for layer, attribute := range config.Settings.PieceOrder {
+		for _, piece := range sortedKeys(config.Attributes[attribute].Pieces) {
+			shade += 50
+			writePiece(t, piecePath(config, attribute, piece), layer, uint8(shade))
+		}
+	}
+	return config
+}
+
+// writePiece writes an 8x8 png, opaque for the bottom layer and partly covering and translucent above it
+func writePiece(t *testing.T, path string, layer int, shade uint8) {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := layer; x < 8; x++ {
+			alpha := uint8(255)
+			if layer > 0 {
+				alpha = uint8(120 + x*10)
+			}
+			img.SetNRGBA(x, y, color.NRGBA{shade, 255 - shade, uint8(y * 30), alpha})
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,38 +1,55 @@
 package generator
 
 import (
-	"bytes"
 	"image"
 	"image/draw"
 	"image/png"
 	"log"
+	"os"
 )
 
-func getImages(files []*bytes.Reader) ([]*image.Image, error) {
-	var images []*image.Image
-	for i := 0; i < len(files); i++ {
-		img, err := png.Decode(files[i])
-		if err != nil {
-			return nil, err
-		}
-		images = append(images, &img)
+// decodePiece reads a piece and converts it to RGBA so layering can use the fast draw paths
+func decodePiece(path string) (*image.RGBA, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba, nil
 	}
-	return images, nil
+	rgba := image.NewRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	return rgba, nil
 }
 
-func buildImage(images []*image.Image, i int) *image.RGBA {
-	baseImage := *images[0]
+// buildImage layers the images in order, starting from the deepest composite cached for the
+// prefix keys of the layers and caching the composites other images share
+func buildImage(composites *compositeCache, keys []string, images []*image.RGBA, i int) *image.RGBA {
+	baseImage := images[0]
 	rect := image.Rectangle{baseImage.Bounds().Min, baseImage.Bounds().Max}
 	img := image.NewRGBA(rect)
 	origin := image.Point{0, 0}
-	log.Printf("Layering assets for image #%d\n", i)
-	for i := 0; i < len(images); i++ {
-		currImg := *images[i]
+	start, composite := composites.lookup(keys[:len(keys)-1])
+	if composite != nil {
+		copy(img.Pix, composite.Pix)
+	}
+	log.Printf("Layering assets for image #%d from layer %d\n", i, start)
+	for i := start; i < len(images); i++ {
+		currImg := images[i]
 		if i == 0 {
 			draw.Draw(img, currImg.Bounds(), currImg, origin, draw.Src)
 		} else {
 			draw.Draw(img, currImg.Bounds(), currImg, origin, draw.Over)
 		}
+		if i < len(images)-1 {
+			composites.store(keys[i], img)
+		}
 	}
+	composites.release(keys)
 	return img
 }
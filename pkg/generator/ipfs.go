@@ -0,0 +1,100 @@
+package generator
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	conf "github.com/clickpop/looks/pkg/config"
+	"github.com/clickpop/looks/pkg/ipfs"
+)
+
+func ipfsEnabled(output conf.OutputObject) bool {
+	return output.IPFS || output.CARFile != ""
+}
+
+// imageDirectory returns the link to a directory holding the images of the run, or an empty
+// link when ipfs is disabled
+func imageDirectory(output conf.OutputObject, tokens []renderedToken) (ipfs.Link, error) {
+	if !ipfsEnabled(output) {
+		return ipfs.Link{}, nil
+	}
+	directory, err := ipfs.Directory(imageLinks(tokens), nil)
+	if err != nil {
+		return ipfs.Link{}, err
+	}
+	log.Printf("Image directory CID %s", directory.CID)
+	return directory, nil
+}
+
+func imageLinks(tokens []renderedToken) []ipfs.Link {
+	links := make([]ipfs.Link, len(tokens))
+	for i, token := range tokens {
+		links[i] = token.file.cid
+	}
+	return links
+}
+
+// writeCar packs the image directory and, when metadata files are written, the metadata
+// directory into a CARv1 file with both directories as roots. For cip25 the metadata directory
+// holds meta.json. The files are read back from the output directory so the images do not
+// have to stay in memory
+func writeCar(config *conf.Config, tokens []renderedToken, metaFiles []ipfs.Link) error {
+	imageDir, err := ipfs.Directory(imageLinks(tokens), nil)
+	if err != nil {
+		return err
+	}
+	roots := []ipfs.CID{imageDir.CID}
+	if len(metaFiles) > 0 {
+		metaDir, err := ipfs.Directory(metaFiles, nil)
+		if err != nil {
+			return err
+		}
+		log.Printf("Metadata directory CID %s", metaDir.CID)
+		roots = append(roots, metaDir.CID)
+	}
+
+	out, err := os.Create(config.Output.CARFile)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	buffered := bufio.NewWriter(out)
+	car, err := ipfs.NewCarWriter(buffered, roots)
+	if err != nil {
+		return err
+	}
+
+	packFiles := func(links []ipfs.Link) error {
+		for _, link := range links {
+			data, err := os.ReadFile(filepath.Join(config.Output.Local.Directory, link.Name))
+			if err != nil {
+				return err
+			}
+			packed, err := ipfs.File(data, car.Write)
+			if err != nil {
+				return err
+			}
+			if packed.CID != link.CID {
+				return fmt.Errorf("%s changed while generating", link.Name)
+			}
+		}
+		_, err := ipfs.Directory(links, car.Write)
+		return err
+	}
+	if err := packFiles(imageLinks(tokens)); err != nil {
+		return err
+	}
+	if len(metaFiles) > 0 {
+		if err := packFiles(metaFiles); err != nil {
+			return err
+		}
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	log.Printf("Wrote %s", config.Output.CARFile)
+	return out.Close()
+}
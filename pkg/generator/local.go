@@ -2,28 +2,74 @@ package generator
 
 import (
 	"fmt"
-	"image"
-	"image/png"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	conf "github.com/clickpop/looks/pkg/config"
 )
 
-func storeFile(config *conf.Config, img image.Image, jsonData []byte, i int) error {
-	out, err := os.Create(fmt.Sprintf("%s/%d.png", config.Output.Local.Directory, i))
+// metaFilename returns the name of the metadata file of a token, erc1155 uses the 64 character hex id clients
+// substitute for {id}. Images keep their decimal names for every meta format
+func metaFilename(output conf.OutputObject, i int) string {
+	if output.MetaFormat == conf.ERC1155 {
+		return fmt.Sprintf("%064x.json", i)
+	}
+	return fmt.Sprintf("%d.json", i)
+}
+
+// metaFileID returns the token id of a metadata filename
+func metaFileID(output conf.OutputObject, filename string) (int, bool) {
+	name := strings.TrimSuffix(filename, ".json")
+	if name == filename {
+		return 0, false
+	}
+	base := 10
+	if output.MetaFormat == conf.ERC1155 {
+		if len(name) != 64 {
+			return 0, false
+		}
+		base = 16
+	}
+	id, err := strconv.ParseInt(name, base, 0)
+	if err != nil || id < 0 {
+		return 0, false
+	}
+	return int(id), true
+}
+
+// storeImage writes the encoded image of a token to the output directory
+func storeImage(config *conf.Config, imageData []byte, i int) error {
+	filename := imageFilename(config.Output, i)
+	err := os.WriteFile(filepath.Join(config.Output.Local.Directory, filename), imageData, 0666)
 	if err != nil {
 		return err
 	}
-	png.Encode(out, img)
-	out.Close()
-	log.Printf("Image #%d.png created\n", i)
-	if config.Output.IncludeMeta && config.Output.MetaFormat == conf.JSON && jsonData != nil {
-		err = os.WriteFile(fmt.Sprintf("./%s/%d.json", config.Output.Local.Directory, i), jsonData, 0666)
-		if err != nil {
-			return err
-		}
-		log.Printf("Metadata #%d.json created\n", i)
+	log.Printf("Image #%s created\n", filename)
+	return nil
+}
+
+// tokenMetaFiles reports if the meta format is written as a json file per token
+func tokenMetaFiles(output conf.OutputObject) bool {
+	switch output.MetaFormat {
+	case conf.JSON, conf.Metaplex, conf.TZIP21, conf.ERC1155:
+		return output.IncludeMeta
+	}
+	return false
+}
+
+// storeMeta writes the json metadata of a token to the output directory
+func storeMeta(config *conf.Config, jsonData []byte, i int) error {
+	if !tokenMetaFiles(config.Output) {
+		return nil
+	}
+	filename := metaFilename(config.Output, i)
+	err := os.WriteFile(filepath.Join(config.Output.Local.Directory, filename), jsonData, 0666)
+	if err != nil {
+		return err
 	}
+	log.Printf("Metadata #%s created\n", filename)
 	return nil
 }
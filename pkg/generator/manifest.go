@@ -0,0 +1,343 @@
+package generator
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	conf "github.com/clickpop/looks/pkg/config"
+	"github.com/clickpop/looks/pkg/ipfs"
+)
+
+const manifestFilename = "collection.json"
+
+// Manifest lists every token of a generated collection with its files, the pieces it was built
+// from and the content hashes of its files. Paths are relative to the output directory
+type Manifest struct {
+	Seed              int64            `json:"seed"`
+	ImageFormat       conf.ImageFormat `json:"image_format"`
+	MetaFormat        conf.MetaFormat  `json:"meta_format,omitempty"`
+	ImageDirectoryCID string           `json:"image_directory_cid,omitempty"`
+	Tokens            []ManifestToken  `json:"tokens"`
+
+	// fromMeta is set on manifests rebuilt from metadata files, which do not record the seed
+	fromMeta bool
+}
+
+// ManifestToken describes a single token. Selection maps every attribute to the key of its
+// piece, attributes left empty are missing
+type ManifestToken struct {
+	ID          int                    `json:"id"`
+	Image       string                 `json:"image"`
+	ImageSHA256 string                 `json:"image_sha256"`
+	ImageCID    string                 `json:"image_cid,omitempty"`
+	Meta        string                 `json:"meta,omitempty"`
+	MetaSHA256  string                 `json:"meta_sha256,omitempty"`
+	MetaCID     string                 `json:"meta_cid,omitempty"`
+	DNA         string                 `json:"dna"`
+	Selection   map[string]string      `json:"selection"`
+	Traits      map[string]interface{} `json:"traits,omitempty"`
+	Stats       map[string]int         `json:"stats,omitempty"`
+	RarityRank  int                    `json:"rarity_rank,omitempty"`
+	RarityScore float64                `json:"rarity_score,omitempty"`
+}
+
+// newManifest returns nil, ignoring tokens, unless the manifest is enabled
+func newManifest(config *conf.Config, seed int64, directory ipfs.Link) *Manifest {
+	if !config.Output.Manifest {
+		return nil
+	}
+	manifest := &Manifest{
+		Seed:        seed,
+		ImageFormat: imageFormat(config.Output),
+		Tokens:      make([]ManifestToken, 0, int(config.Output.ImageCount)),
+	}
+	if config.Output.IncludeMeta {
+		manifest.MetaFormat = config.Output.MetaFormat
+	}
+	if directory.CID.Defined() {
+		manifest.ImageDirectoryCID = directory.CID.String()
+	}
+	return manifest
+}
+
+// metaLocation returns the file holding the metadata of a token
+func metaLocation(output conf.OutputObject, i int) string {
+	switch {
+	case tokenMetaFiles(output):
+		return metaFilename(output, i)
+	case !output.IncludeMeta:
+		return ""
+	case output.MetaFormat == conf.CSV:
+		return "meta.csv"
+	case output.MetaFormat == conf.CIP25:
+		return cip25Filename
+	case output.MetaFormat == conf.JSONL:
+		return "meta.jsonl"
+	}
+	return ""
+}
+
+func (m *Manifest) add(config *conf.Config, i int, token renderedToken, meta []byte) {
+	if m == nil {
+		return
+	}
+	entry := ManifestToken{
+		ID:          i,
+		Image:       token.file.filename,
+		ImageSHA256: token.file.hash,
+		Meta:        metaLocation(config.Output, i),
+		DNA:         token.dna,
+		Selection:   make(map[string]string, len(token.selection)),
+	}
+	if token.file.cid.CID.Defined() {
+		entry.ImageCID = token.file.cid.CID.String()
+	}
+	if tokenMetaFiles(config.Output) {
+		sum := sha256.Sum256(meta)
+		entry.MetaSHA256 = hex.EncodeToString(sum[:])
+	}
+	for attribute, piece := range token.selection {
+		if piece != emptyPiece {
+			entry.Selection[attribute] = piece
+		}
+	}
+	if config.Output.IncludeMeta {
+		statNames := make(map[string]bool, len(config.Settings.Stats))
+		for key := range config.Settings.Stats {
+			statNames[statName(config, key)] = true
+		}
+		entry.Traits = make(map[string]interface{}, len(token.meta.Attributes))
+		for _, attribute := range token.meta.Attributes {
+			if value, ok := attribute.Value.(int); ok && statNames[attribute.TraitType] {
+				if entry.Stats == nil {
+					entry.Stats = make(map[string]int)
+				}
+				entry.Stats[attribute.TraitType] = value
+				continue
+			}
+			entry.Traits[attribute.TraitType] = attribute.Value
+		}
+	}
+	m.Tokens = append(m.Tokens, entry)
+}
+
+// linkMeta records the CIDs of the metadata files, either one per token or, for cip25, a single
+// file shared by every token
+func (m *Manifest) linkMeta(links []ipfs.Link) {
+	if m == nil || len(links) == 0 {
+		return
+	}
+	for i := range m.Tokens {
+		link := links[0]
+		if len(links) == len(m.Tokens) {
+			link = links[i]
+		}
+		m.Tokens[i].MetaCID = link.CID.String()
+	}
+}
+
+// rank records the rarity of the token added last
+func (m *Manifest) rank(rank tokenRank) {
+	if m == nil {
+		return
+	}
+	m.Tokens[len(m.Tokens)-1].RarityRank = rank.rank
+	m.Tokens[len(m.Tokens)-1].RarityScore = roundScore(rank.score)
+}
+
+func (m *Manifest) write(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0666)
+}
+
+// ReadManifest loads the manifest of a generated collection
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &manifest, nil
+}
+
+// LoadManifest loads the manifest of the collection in dir. Without a collection.json the manifest is
+// rebuilt from the metadata files, mapping the traits back to pieces through the names of the config.
+// Hashes, CIDs and the seed are unknown then
+func LoadManifest(config *conf.Config, dir string) (*Manifest, error) {
+	manifest, err := ReadManifest(filepath.Join(dir, manifestFilename))
+	if !errors.Is(err, os.ErrNotExist) {
+		return manifest, err
+	}
+	output := config.Output
+	if !output.IncludeMeta || !(tokenMetaFiles(output) || output.MetaFormat == conf.JSONL) {
+		return nil, fmt.Errorf("no %s in %s and the collection can only be read back from json or jsonl metadata, generate with output.manifest set to write it", manifestFilename, dir)
+	}
+	documents, err := readMetaDocuments(output, dir)
+	if err != nil {
+		return nil, err
+	}
+	pieces := pieceKeys(config)
+	statNames := make(map[string]bool, len(config.Settings.Stats))
+	for key := range config.Settings.Stats {
+		statNames[statName(config, key)] = true
+	}
+
+	manifest = &Manifest{
+		ImageFormat: imageFormat(output),
+		MetaFormat:  output.MetaFormat,
+		Tokens:      make([]ManifestToken, 0, len(documents)),
+		fromMeta:    true,
+	}
+	for _, document := range documents {
+		traits := documentTraits(output, document.meta)
+		selection := make(map[string]string, len(config.Settings.PieceOrder))
+		for _, attribute := range config.Settings.PieceOrder {
+			name := attributeName(config, attribute)
+			value, ok := traits[name]
+			if !ok {
+				selection[attribute] = emptyPiece
+				continue
+			}
+			delete(traits, name)
+			key, ok := pieces[attribute][fmt.Sprint(value)]
+			if !ok {
+				return nil, fmt.Errorf("%s: %s %v is not a piece of the config", document.path, name, value)
+			}
+			if key == "" {
+				return nil, fmt.Errorf("%s: %s %v names more than one piece of the config", document.path, name, value)
+			}
+			selection[attribute] = key
+		}
+		token := ManifestToken{
+			ID:        document.id,
+			Image:     imageFilename(output, document.id),
+			Meta:      metaLocation(output, document.id),
+			DNA:       buildDNA(config, selection),
+			Selection: make(map[string]string, len(selection)),
+			Traits:    make(map[string]interface{}, len(traits)),
+		}
+		for attribute, piece := range selection {
+			if piece != emptyPiece {
+				token.Selection[attribute] = piece
+			}
+		}
+		for name, value := range traits {
+			if number, ok := value.(float64); ok && statNames[name] {
+				if token.Stats == nil {
+					token.Stats = make(map[string]int)
+				}
+				token.Stats[name] = int(number)
+				continue
+			}
+			token.Traits[name] = value
+		}
+		manifest.Tokens = append(manifest.Tokens, token)
+	}
+	return manifest, nil
+}
+
+type metaDocument struct {
+	id   int
+	path string
+	meta map[string]interface{}
+}
+
+// readMetaDocuments decodes the metadata of every token in dir, from a file per token or from meta.jsonl
+func readMetaDocuments(output conf.OutputObject, dir string) ([]metaDocument, error) {
+	var documents []metaDocument
+	if output.MetaFormat == conf.JSONL {
+		path := filepath.Join(dir, "meta.jsonl")
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(nil, len(data)+1)
+		for id := 0; scanner.Scan(); id++ {
+			document := metaDocument{id: id, path: fmt.Sprintf("%s:%d", path, id+1)}
+			if err := json.Unmarshal(scanner.Bytes(), &document.meta); err != nil {
+				return nil, fmt.Errorf("%s: %w", document.path, err)
+			}
+			documents = append(documents, document)
+		}
+		return documents, scanner.Err()
+	}
+	ids, err := metaFileIDs(output, dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		document := metaDocument{id: id, path: filepath.Join(dir, metaFilename(output, id))}
+		data, err := os.ReadFile(document.path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &document.meta); err != nil {
+			return nil, fmt.Errorf("%s: %w", document.path, err)
+		}
+		documents = append(documents, document)
+	}
+	return documents, nil
+}
+
+// documentTraits collects the traits of a decoded metadata document by name, from its attributes,
+// named by trait_type or by name for tzip21, and the properties of erc1155
+func documentTraits(output conf.OutputObject, meta map[string]interface{}) map[string]interface{} {
+	traits := make(map[string]interface{})
+	attributes, _ := meta["attributes"].([]interface{})
+	for _, attribute := range attributes {
+		fields, ok := attribute.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, ok := fields["trait_type"].(string)
+		if !ok {
+			name, _ = fields["name"].(string)
+		}
+		if name != "" {
+			traits[name] = fields["value"]
+		}
+	}
+	if output.MetaFormat == conf.ERC1155 {
+		properties, _ := meta["properties"].(map[string]interface{})
+		for name, value := range properties {
+			traits[name] = value
+		}
+	}
+	return traits
+}
+
+// pieceKeys maps the trait value of every piece back to its key by attribute, empty-values map to
+// emptyPiece. Values shared by several pieces map to an empty key
+func pieceKeys(config *conf.Config) map[string]map[string]string {
+	keys := make(map[string]map[string]string, len(config.Settings.PieceOrder))
+	for _, attribute := range config.Settings.PieceOrder {
+		keys[attribute] = make(map[string]string)
+		add := func(name string, key string) {
+			if _, ok := keys[attribute][name]; ok {
+				key = ""
+			}
+			keys[attribute][name] = key
+		}
+		for key := range config.Attributes[attribute].Pieces {
+			add(pieceName(config, attribute, key), key)
+		}
+		if value := config.Attributes[attribute].EmptyValue; value != "" {
+			add(value, emptyPiece)
+		}
+	}
+	return keys
+}
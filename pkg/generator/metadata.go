@@ -3,27 +3,66 @@ package generator
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"math/rand"
 	"sort"
-	"strings"
 	"time"
 
 	conf "github.com/clickpop/looks/pkg/config"
+	"github.com/clickpop/looks/pkg/ipfs"
 )
 
-var csv [][]string
+// timestampValue returns the unix time of a timestamp attribute: its value, in seconds or as an
+// RFC 3339 date, or started when it has none
+func timestampValue(attribute conf.ConfigAttribute, started int64) (int64, error) {
+	switch value := attribute.Value.(type) {
+	case nil:
+		return started, nil
+	case int:
+		return int64(value), nil
+	case int64:
+		return value, nil
+	case float64:
+		if value == math.Trunc(value) {
+			return int64(value), nil
+		}
+	case string:
+		date, err := time.Parse(time.RFC3339, value)
+		if err == nil {
+			return date.Unix(), nil
+		}
+	}
+	return 0, fmt.Errorf("timestamp value %v is neither unix seconds nor an RFC 3339 date", attribute.Value)
+}
+
+// checkTimestamp rejects timestamp attributes whose value is neither unix seconds nor an RFC 3339 date
+func checkTimestamp(attribute conf.ConfigAttribute) error {
+	if attribute.Type != "timestamp" {
+		return nil
+	}
+	_, err := timestampValue(attribute, 0)
+	return err
+}
 
-func generateMeta(metadata Metadata, config *conf.Config, i int) ([]byte, error) {
+// tokenMeta builds the name, description and traits of a token. Timestamp attributes without
+// a value are set to started, the time of the collection seed
+func tokenMeta(rng *rand.Rand, metadata Metadata, config *conf.Config, i int, started int64) OpenSeaMeta {
 	var finalMeta OpenSeaMeta
 	finalMeta.Attributes = make([]OpenSeaAttribute, 0)
 	stats := make(map[string]conf.ConfigStat)
-	for _, v := range config.Settings.Stats {
+	for k, v := range config.Settings.Stats {
 		attr := v
+		attr.Name = statName(config, k)
 		attr.Value = 0
 		stats[attr.Name] = attr
 	}
 	for j := 0; j < len(metadata.PieceMeta); j++ {
 		currMeta := metadata.PieceMeta[j]
-		finalMeta.Attributes = append(finalMeta.Attributes, OpenSeaAttribute{TraitType: currMeta.Type, Value: currMeta.Piece})
+		attribute := OpenSeaAttribute{TraitType: currMeta.Type, Value: currMeta.Piece}
+		if config.Output.Probability {
+			attribute.Probability = math.Round(currMeta.Probability*10000) / 10000
+		}
+		finalMeta.Attributes = append(finalMeta.Attributes, attribute)
 		sort.Slice(finalMeta.Attributes, func(i, j int) bool {
 			return finalMeta.Attributes[i].TraitType < finalMeta.Attributes[j].TraitType
 		})
@@ -38,10 +77,22 @@ func generateMeta(metadata Metadata, config *conf.Config, i int) ([]byte, error)
 			stats[v.Name] = attr
 		}
 	}
-	for k, v := range stats {
+	statNames := make([]string, 0, len(stats))
+	for k := range stats {
+		statNames = append(statNames, k)
+	}
+	sort.Strings(statNames)
+	for _, k := range statNames {
+		v := stats[k]
 		finalMeta.Attributes = append(finalMeta.Attributes, OpenSeaAttribute{TraitType: k, Value: v.Value, DisplayType: "number", MaxValue: v.Maximum})
 	}
-	for k, v := range config.Settings.Attributes {
+	attrKeys := make([]string, 0, len(config.Settings.Attributes))
+	for k := range config.Settings.Attributes {
+		attrKeys = append(attrKeys, k)
+	}
+	sort.Strings(attrKeys)
+	for _, k := range attrKeys {
+		v := config.Settings.Attributes[k]
 		val := v.Value
 		name := v.Name
 		attrType := v.Type
@@ -52,16 +103,26 @@ func generateMeta(metadata Metadata, config *conf.Config, i int) ([]byte, error)
 		switch v.Type {
 		case "timestamp":
 			attrType = "date"
-			val = time.Now().Unix()
+			val, _ = timestampValue(v, started)
 		}
 		finalMeta.Attributes = append(finalMeta.Attributes, OpenSeaAttribute{TraitType: name, DisplayType: attrType, Value: val})
 	}
 	if config.Output.IncludeMeta {
-		description, name := buildDescription(config, finalMeta)
+		description, name := buildDescription(rng, config, finalMeta)
 		finalMeta.Description = description
 		finalMeta.Attributes = append(finalMeta.Attributes, OpenSeaAttribute{TraitType: "Type", Value: name})
 	}
 	finalMeta.Name = fmt.Sprint(i)
+	return finalMeta
+}
+
+// generateMeta fills in the links to the final image of a token and encodes its metadata in the configured meta format.
+// For cip25 and jsonl this is the entry of the token, the entries of a run are stored together
+func generateMeta(finalMeta OpenSeaMeta, config *conf.Config, table *csvTable, i int, file imageFile, directory ipfs.Link) ([]byte, error) {
+	placeholders := uriPlaceholders(i, file, directory)
+	finalMeta.Image = imageURI(config.Output, i, placeholders)
+	finalMeta.ExternalURL = placeholders.Replace(config.Output.ExternalURL)
+	table.addRow(i, finalMeta)
 	switch config.Output.MetaFormat {
 	case conf.JSON:
 		jsonData, err := json.MarshalIndent(finalMeta, "", "  ")
@@ -69,51 +130,17 @@ func generateMeta(metadata Metadata, config *conf.Config, i int) ([]byte, error)
 			return nil, err
 		}
 		return jsonData, nil
-	case conf.CSV:
-		buildCsvRow(finalMeta)
-		return nil, nil
+	case conf.Metaplex:
+		return json.MarshalIndent(metaplexMeta(finalMeta, config.Output), "", "  ")
+	case conf.TZIP21:
+		thumbnail := placeholders.Replace(config.Output.Tezos.ThumbnailURI)
+		return json.MarshalIndent(tzip21Meta(finalMeta, config.Output, thumbnail, file), "", "  ")
+	case conf.CIP25:
+		return json.MarshalIndent(cip25Meta(finalMeta, config.Output), "", "  ")
+	case conf.JSONL:
+		return json.Marshal(finalMeta)
+	case conf.ERC1155:
+		return json.MarshalIndent(erc1155Meta(finalMeta, config.Output), "", "  ")
 	}
 	return nil, nil
 }
-
-func buildCsvHeading(config *conf.Config) {
-	csv = make([][]string, 0)
-	headings := make([]string, 0)
-	headings = append(headings, "Name")
-	headings = append(headings, "Description")
-	for k := range config.Attributes {
-		headings = append(headings, strings.Title(k))
-	}
-	for k := range config.Settings.Stats {
-		headings = append(headings, strings.Title(k))
-	}
-	csv = append(csv, headings)
-}
-
-func buildCsvRow(meta OpenSeaMeta) {
-	rowMap := make(map[string]interface{})
-	rowMap["Name"] = meta.Name
-	rowMap["Description"] = meta.Description
-	for _, attribute := range meta.Attributes {
-		rowMap[strings.Title(attribute.TraitType)] = attribute.Value
-	}
-	row := make([]string, 0)
-	for _, col := range csv[0] {
-		if rowMap[col] != nil {
-			if val, ok := rowMap[col].(string); ok {
-				if val != "" {
-					row = append(row, val)
-				}
-			}
-
-			if val, ok := rowMap[col].(int); ok {
-				if val != 0 {
-					row = append(row, fmt.Sprint(val))
-				}
-			}
-		} else {
-			row = append(row, "")
-		}
-	}
-	csv = append(csv, row)
-}
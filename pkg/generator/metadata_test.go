@@ -0,0 +1,108 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+func TestTimestampValue(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  int64
+		ok    bool
+	}{
+		{nil, 1000, true},
+		{1704164645, 1704164645, true},
+		{float64(1704164645), 1704164645, true},
+		{"2024-01-02T03:04:05Z", 1704164645, true},
+		{1.5, 0, false},
+		{"yesterday", 0, false},
+	}
+	for _, test := range tests {
+		got, err := timestampValue(conf.ConfigAttribute{Type: "timestamp", Value: test.value}, 1000)
+		if (err == nil) != test.ok || got != test.want {
+			t.Errorf("timestampValue(%v) = %d, %v", test.value, got, err)
+		}
+	}
+}
+
+func TestSeedTime(t *testing.T) {
+	if got := seedTime(1704164645123456789); got != 1704164645 {
+		t.Errorf("seedTime = %d, want the seconds of the seed", got)
+	}
+	seed := int64(0)
+	config := testConfig(1)
+	config.Settings.Seed = &seed
+	config.Settings.Attributes = map[string]conf.ConfigAttribute{"born": {Type: "timestamp"}}
+	if _, err := New(config); err != nil {
+		t.Errorf("unexpected error for a timestamp without value when a seed is set: %s", err)
+	}
+}
+
+func TestCollectionSeedKeepsZero(t *testing.T) {
+	seed := int64(0)
+	config := &conf.Config{}
+	config.Settings.Seed = &seed
+	if got := collectionSeed(config); got != 0 {
+		t.Errorf("collectionSeed = %d, want the configured 0", got)
+	}
+}
+
+func TestTokenMetaProbabilityIsOptIn(t *testing.T) {
+	config := testConfig(1)
+	metadata := Metadata{PieceMeta: []PieceMetadata{{Type: "Background", Piece: "Blue", Probability: 0.123456}}}
+	for _, enabled := range []bool{false, true} {
+		config.Output.Probability = enabled
+		meta := tokenMeta(rand.New(rand.NewSource(1)), metadata, config, 0, 0)
+		want := 0.0
+		if enabled {
+			want = 0.1235
+		}
+		if got := meta.Attributes[0].Probability; got != want {
+			t.Errorf("probability %t: attribute has probability %f, want %f", enabled, got, want)
+		}
+	}
+}
+
+func TestProbabilityHonoursConstraints(t *testing.T) {
+	config := renderConfig(t, 7)
+	config.Output.Probability = true
+	// the tiers alone give the crown 0.75 * 0.2 = 0.15, but with a single crown seven tokens only
+	// fit when the six combinations without it and one with it are used
+	config.Attributes["hat"].Pieces["crown"] = conf.PieceAttribute{Rarity: "rare", MaxSupply: 1}
+	g, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Generate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	crowns := 0
+	for i := 0; i < 7; i++ {
+		data, err := os.ReadFile(filepath.Join(config.Output.Local.Directory, metaFilename(config.Output, i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var meta OpenSeaMeta
+		if err := json.Unmarshal(data, &meta); err != nil {
+			t.Fatal(err)
+		}
+		for _, attribute := range meta.Attributes {
+			if attribute.Value == "Crown" {
+				crowns++
+				if attribute.Probability != 0.1429 {
+					t.Errorf("crown has probability %f, want one in seven", attribute.Probability)
+				}
+			}
+		}
+	}
+	if crowns != 1 {
+		t.Errorf("%d crowns, want one", crowns)
+	}
+}
@@ -0,0 +1,87 @@
+package generator
+
+import (
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+// MetaplexMeta is the Metaplex token metadata standard used on Solana
+type MetaplexMeta struct {
+	Name                 string              `json:"name"`
+	Symbol               string              `json:"symbol"`
+	Description          string              `json:"description"`
+	SellerFeeBasisPoints int                 `json:"seller_fee_basis_points"`
+	Image                string              `json:"image"`
+	AnimationURL         string              `json:"animation_url,omitempty"`
+	ExternalURL          string              `json:"external_url,omitempty"`
+	Attributes           []MetaplexAttribute `json:"attributes"`
+	Collection           *MetaplexCollection `json:"collection,omitempty"`
+	Properties           MetaplexProperties  `json:"properties"`
+}
+
+type MetaplexAttribute struct {
+	TraitType string      `json:"trait_type"`
+	Value     interface{} `json:"value"`
+}
+
+type MetaplexCollection struct {
+	Name   string `json:"name"`
+	Family string `json:"family,omitempty"`
+}
+
+type MetaplexProperties struct {
+	Files    []MetaplexFile    `json:"files"`
+	Category string            `json:"category"`
+	Creators []MetaplexCreator `json:"creators"`
+}
+
+type MetaplexFile struct {
+	URI  string `json:"uri"`
+	Type string `json:"type"`
+}
+
+type MetaplexCreator struct {
+	Address string `json:"address"`
+	Share   int    `json:"share"`
+}
+
+func imageMimeType(output conf.OutputObject) string {
+	switch imageFormat(output) {
+	case conf.JPEG:
+		return "image/jpeg"
+	case conf.GIF:
+		return "image/gif"
+	case conf.WebP:
+		return "image/webp"
+	}
+	return "image/png"
+}
+
+// metaplexMeta converts the metadata of a token to the Metaplex standard, adding the collection-level fields of the config
+func metaplexMeta(meta OpenSeaMeta, output conf.OutputObject) MetaplexMeta {
+	settings := output.Metaplex
+	out := MetaplexMeta{
+		Name:                 meta.Name,
+		Symbol:               settings.Symbol,
+		Description:          meta.Description,
+		SellerFeeBasisPoints: settings.SellerFeeBasisPoints,
+		Image:                meta.Image,
+		AnimationURL:         meta.AnimationURL,
+		ExternalURL:          meta.ExternalURL,
+		Attributes:           make([]MetaplexAttribute, 0, len(meta.Attributes)),
+		Properties: MetaplexProperties{
+			Files:    []MetaplexFile{{URI: meta.Image, Type: imageMimeType(output)}},
+			Category: "image",
+			Creators: make([]MetaplexCreator, 0, len(settings.Creators)),
+		},
+	}
+	for _, attribute := range meta.Attributes {
+		out.Attributes = append(out.Attributes, MetaplexAttribute{TraitType: attribute.TraitType, Value: attribute.Value})
+	}
+	for _, creator := range settings.Creators {
+		out.Properties.Creators = append(out.Properties.Creators, MetaplexCreator{Address: creator.Address, Share: creator.Share})
+	}
+	if settings.Collection.Name != "" {
+		out.Collection = &MetaplexCollection{Name: settings.Collection.Name, Family: settings.Collection.Family}
+	}
+	return out
+}
@@ -0,0 +1,44 @@
+package generator
+
+import (
+	"encoding/json"
+	"testing"
+
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+func TestMetaplexMeta(t *testing.T) {
+	output := conf.OutputObject{MetaFormat: conf.Metaplex, ImageFormat: conf.JPEG}
+	output.Metaplex = conf.OutputMetaplex{
+		Symbol:               "RAT",
+		SellerFeeBasisPoints: 500,
+		Creators:             []conf.MetaplexCreator{{Address: "So1creator", Share: 100}},
+	}
+	meta := OpenSeaMeta{
+		Name:        "7",
+		Description: "A rat",
+		Image:       "https://example.com/7.jpg",
+		Attributes:  []OpenSeaAttribute{{TraitType: "Headwear", Value: "Crown"}, {TraitType: "Wit", Value: 0, DisplayType: "number"}},
+	}
+	base := `{"name":"7","symbol":"RAT","description":"A rat","seller_fee_basis_points":500,"image":"https://example.com/7.jpg",` +
+		`"attributes":[{"trait_type":"Headwear","value":"Crown"},{"trait_type":"Wit","value":0}]`
+	properties := `"properties":{"files":[{"uri":"https://example.com/7.jpg","type":"image/jpeg"}],"category":"image",` +
+		`"creators":[{"address":"So1creator","share":100}]}}`
+	tests := []struct {
+		collection conf.MetaplexCollection
+		want       string
+	}{
+		{conf.MetaplexCollection{}, base + "," + properties},
+		{conf.MetaplexCollection{Name: "Rats", Family: "Looks"}, base + `,"collection":{"name":"Rats","family":"Looks"},` + properties},
+	}
+	for _, test := range tests {
+		output.Metaplex.Collection = test.collection
+		data, err := json.Marshal(metaplexMeta(meta, output))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != test.want {
+			t.Errorf("collection %q:\n%s\nwant\n%s", test.collection.Name, data, test.want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package generator
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"strconv"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// PNGText is a text chunk of a png
+type PNGText struct {
+	Keyword string
+	Text    string
+}
+
+// tokenText returns the text chunks describing a token
+func tokenText(meta OpenSeaMeta, seed int64) ([]PNGText, error) {
+	traits, err := json.Marshal(meta.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	chunks := []PNGText{
+		{Keyword: "Title", Text: meta.Name},
+		{Keyword: "Software", Text: "looks"},
+		{Keyword: "looks:seed", Text: strconv.FormatInt(seed, 10)},
+		{Keyword: "looks:traits", Text: string(traits)},
+	}
+	if meta.Description != "" {
+		chunks = append(chunks, PNGText{Keyword: "Description", Text: meta.Description})
+	}
+	return chunks, nil
+}
+
+// embedPNGText inserts uncompressed iTXt chunks right after the IHDR chunk of an encoded png
+func embedPNGText(data []byte, texts []PNGText) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) || len(data) < len(pngSignature)+8 {
+		return nil, errors.New("not a png")
+	}
+	ihdrLength := int(binary.BigEndian.Uint32(data[len(pngSignature):]))
+	ihdrEnd := len(pngSignature) + 12 + ihdrLength
+	if ihdrEnd > len(data) {
+		return nil, errors.New("truncated png")
+	}
+
+	var out bytes.Buffer
+	out.Write(data[:ihdrEnd])
+	for _, text := range texts {
+		var chunk bytes.Buffer
+		chunk.WriteString(text.Keyword)
+		// null separator, no compression, compression method, empty language tag and translated keyword
+		chunk.Write([]byte{0, 0, 0, 0, 0})
+		chunk.WriteString(text.Text)
+		writePNGChunk(&out, "iTXt", chunk.Bytes())
+	}
+	out.Write(data[ihdrEnd:])
+	return out.Bytes(), nil
+}
+
+func writePNGChunk(w io.Writer, chunkType string, data []byte) {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(len(data)))
+	copy(header[4:], chunkType)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	footer := make([]byte, 4)
+	binary.BigEndian.PutUint32(footer, crc.Sum32())
+	w.Write(header)
+	w.Write(data)
+	w.Write(footer)
+}
+
+// ReadPNGText returns the tEXt, zTXt and iTXt chunks of a png in the order they appear
+func ReadPNGText(r io.Reader) ([]PNGText, error) {
+	signature := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(r, signature); err != nil || !bytes.Equal(signature, pngSignature) {
+		return nil, errors.New("not a png")
+	}
+	var texts []PNGText
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, fmt.Errorf("reading chunk: %w", err)
+		}
+		length := binary.BigEndian.Uint32(header)
+		chunkType := string(header[4:])
+		data := make([]byte, int(length)+4)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("reading %s chunk: %w", chunkType, err)
+		}
+		data = data[:length]
+		switch chunkType {
+		case "tEXt", "zTXt", "iTXt":
+			text, err := parsePNGText(chunkType, data)
+			if err != nil {
+				return nil, err
+			}
+			texts = append(texts, text)
+		case "IEND":
+			return texts, nil
+		}
+	}
+}
+
+func parsePNGText(chunkType string, data []byte) (PNGText, error) {
+	fields := bytes.SplitN(data, []byte{0}, 2)
+	if len(fields) != 2 {
+		return PNGText{}, fmt.Errorf("malformed %s chunk", chunkType)
+	}
+	text := PNGText{Keyword: string(fields[0])}
+	rest := fields[1]
+	switch chunkType {
+	case "tEXt":
+		text.Text = string(rest)
+	case "zTXt":
+		if len(rest) < 1 {
+			return PNGText{}, fmt.Errorf("malformed %s chunk", chunkType)
+		}
+		inflated, err := inflate(rest[1:])
+		if err != nil {
+			return PNGText{}, err
+		}
+		text.Text = string(inflated)
+	case "iTXt":
+		if len(rest) < 2 {
+			return PNGText{}, fmt.Errorf("malformed %s chunk", chunkType)
+		}
+		compressed := rest[0] == 1
+		parts := bytes.SplitN(rest[2:], []byte{0}, 3)
+		if len(parts) != 3 {
+			return PNGText{}, fmt.Errorf("malformed %s chunk", chunkType)
+		}
+		value := parts[2]
+		if compressed {
+			inflated, err := inflate(value)
+			if err != nil {
+				return PNGText{}, err
+			}
+			value = inflated
+		}
+		text.Text = string(value)
+	}
+	return text, nil
+}
+
+func inflate(data []byte) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
@@ -0,0 +1,57 @@
+package generator
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"reflect"
+	"testing"
+)
+
+func TestEmbeddedPNGTextReadsBack(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 5, 3))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 13)
+	}
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		t.Fatal(err)
+	}
+	meta := OpenSeaMeta{
+		Name:        "7",
+		Description: "A rat in a crown — très chic",
+		Attributes:  []OpenSeaAttribute{{TraitType: "Headwear", Value: "Crown"}, {TraitType: "Wit", Value: 3, DisplayType: "number"}},
+	}
+	texts, err := tokenText(meta, -12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := embedPNGText(encoded.Bytes(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := ReadPNGText(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, texts) {
+		t.Errorf("read %v, want %v", read, texts)
+	}
+	decoded, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("png with text no longer decodes: %s", err)
+	}
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 5; x++ {
+			if got := color.NRGBAModel.Convert(decoded.At(x, y)); got != img.At(x, y) {
+				t.Fatalf("pixel (%d, %d) is %v, want %v", x, y, got, img.At(x, y))
+			}
+		}
+	}
+
+	if _, err := embedPNGText([]byte("GIF89a"), texts); err == nil {
+		t.Error("expected an error embedding text in a gif")
+	}
+}
@@ -0,0 +1,36 @@
+package generator
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math/rand"
+	"time"
+
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+// collectionSeed returns the configured seed, zero included, or a time based one when none is set
+func collectionSeed(config *conf.Config) int64 {
+	if config.Settings.Seed != nil {
+		return *config.Settings.Seed
+	}
+	return time.Now().UnixNano()
+}
+
+// seedTime returns the unix time of a seed read as unix nanoseconds, the start of the run for
+// the time based seed, so generating again with the printed seed gives the same timestamps
+func seedTime(seed int64) int64 {
+	return time.Unix(0, seed).Unix()
+}
+
+// tokenRand derives a random source for a single token from the collection seed,
+// the token id and the attempt number so every token can be reproduced on its own
+func tokenRand(seed int64, id int, attempt int) *rand.Rand {
+	buf := make([]byte, 24)
+	binary.LittleEndian.PutUint64(buf[0:], uint64(seed))
+	binary.LittleEndian.PutUint64(buf[8:], uint64(id))
+	binary.LittleEndian.PutUint64(buf[16:], uint64(attempt))
+	hasher := fnv.New64a()
+	hasher.Write(buf)
+	return rand.New(rand.NewSource(int64(hasher.Sum64())))
+}
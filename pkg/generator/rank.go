@@ -0,0 +1,94 @@
+package generator
+
+import (
+	"log"
+	"math"
+	"sort"
+
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+// tokenRank is the rarity of a token within its collection, rank 1 being the rarest
+type tokenRank struct {
+	score float64
+	rank  int
+}
+
+// rankTokens scores every token by how often its pieces, including empty attributes, appear in the
+// collection. Statistical rarity multiplies the frequencies of the pieces, the lower the rarer.
+// Rarity score adds up their inverse frequencies, the higher the rarer. Tokens with the same score
+// share a rank. Ranks only depend on the selections, so they are known once the tokens are planned
+func rankTokens(config *conf.Config, tokens []tokenPlan) []tokenRank {
+	method := config.Output.RarityRank.Method
+	if method == "" || len(tokens) == 0 {
+		return nil
+	}
+	counts := make(map[pieceRef]int)
+	for _, token := range tokens {
+		for _, attribute := range config.Settings.PieceOrder {
+			counts[pieceRef{attribute: attribute, piece: token.selection[attribute]}]++
+		}
+	}
+
+	total := float64(len(tokens))
+	ranks := make([]tokenRank, len(tokens))
+	for i, token := range tokens {
+		score := 0.0
+		if method == conf.StatisticalRarity {
+			score = 1
+		}
+		for _, attribute := range config.Settings.PieceOrder {
+			frequency := float64(counts[pieceRef{attribute: attribute, piece: token.selection[attribute]}]) / total
+			if method == conf.StatisticalRarity {
+				score *= frequency
+			} else {
+				score += 1 / frequency
+			}
+		}
+		ranks[i].score = score
+	}
+
+	rarer := func(a, b float64) bool {
+		if method == conf.StatisticalRarity {
+			return a < b
+		}
+		return a > b
+	}
+	order := make([]int, len(tokens))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return rarer(ranks[order[i]].score, ranks[order[j]].score) && !sameScore(ranks[order[i]].score, ranks[order[j]].score)
+	})
+	for position, i := range order {
+		ranks[i].rank = position + 1
+		if position > 0 && sameScore(ranks[i].score, ranks[order[position-1]].score) {
+			ranks[i].rank = ranks[order[position-1]].rank
+		}
+	}
+	log.Printf("Ranked %d tokens by %s, rarest is #%d", len(tokens), method, order[0])
+	return ranks
+}
+
+// sameScore compares scores with a tolerance, products of the same frequencies taken in another order can differ in the last bits
+func sameScore(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(math.Abs(a), math.Abs(b))
+}
+
+// rankAttributes returns the rank and score of a token as metadata attributes
+func rankAttributes(rank tokenRank, count int) []OpenSeaAttribute {
+	return []OpenSeaAttribute{
+		{TraitType: "Rarity Rank", DisplayType: "number", Value: rank.rank, MaxValue: count},
+		{TraitType: "Rarity Score", DisplayType: "number", Value: roundScore(rank.score)},
+	}
+}
+
+// roundScore keeps six significant digits
+func roundScore(score float64) float64 {
+	if score == 0 {
+		return 0
+	}
+	scale := math.Pow(10, 5-math.Floor(math.Log10(math.Abs(score))))
+	return math.Round(score*scale) / scale
+}
@@ -0,0 +1,41 @@
+package generator
+
+import (
+	"testing"
+
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+func TestRankTokensShareRanksOnTies(t *testing.T) {
+	plans := []tokenPlan{
+		{selection: map[string]string{"background": "dark", "hat": "cap"}},
+		{selection: map[string]string{"background": "dark", "hat": "cap"}},
+		{selection: map[string]string{"background": "blue", "hat": "crown"}},
+		{selection: map[string]string{"background": "green", "hat": "cap"}},
+		{selection: map[string]string{"background": "dark", "hat": emptyPiece}},
+	}
+	for _, method := range []conf.RarityMethod{conf.StatisticalRarity, conf.RarityScore} {
+		config := testConfig(len(plans))
+		config.Output.RarityRank.Method = method
+		ranks := rankTokens(config, plans)
+		// the blue crown is the rarest, the green cap and the empty hat tie as do the two dark caps
+		want := []int{4, 4, 1, 2, 2}
+		for i, rank := range ranks {
+			if rank.rank != want[i] {
+				t.Errorf("%s: token %d has rank %d with score %f, want %d", method, i, rank.rank, rank.score, want[i])
+			}
+		}
+	}
+}
+
+func TestNewRejectsUnknownRarityMethod(t *testing.T) {
+	config := testConfig(3)
+	config.Output.RarityRank.Method = "popularity"
+	if _, err := New(config); err == nil {
+		t.Error("expected New to reject an unknown rarity method")
+	}
+	config.Output.RarityRank.Method = conf.RarityScore
+	if _, err := New(config); err != nil {
+		t.Errorf("unexpected error for rarity-score: %s", err)
+	}
+}
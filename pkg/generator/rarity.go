@@ -1,8 +1,9 @@
 package generator
 
 import (
+	"fmt"
 	"math/rand"
-	"time"
+	"sort"
 
 	"github.com/clickpop/looks/internal/utils"
 	"github.com/clickpop/looks/pkg/config"
@@ -41,14 +42,11 @@ func getRarityMinimum(r config.ConfigRarity, minRarity string) int {
 	return minimum
 }
 
-func getRarityLevel(r config.ConfigRarity, minRarity string) []string {
+func getRarityLevel(rng *rand.Rand, r config.ConfigRarity, minRarity string) []string {
 	denominator := getRarityDenominator(r)
 	minimum := getRarityMinimum(r, minRarity)
 
-	seed := time.Now().Unix() + int64(time.Now().Nanosecond())
-	rand.Seed(seed)
-
-	random := rand.Intn(denominator-minimum) + minimum
+	random := rng.Intn(denominator-minimum) + minimum
 
 	rarity := []string{r.Order[0]}
 
@@ -66,12 +64,20 @@ func getRarityLevel(r config.ConfigRarity, minRarity string) []string {
 	return rarity
 }
 
-func handleRarity(pieceTypes map[string]config.PieceAttribute, rarityData config.ConfigRarity, outputOpt config.OutputObject) (string, config.PieceAttribute) {
-	rarityLevel := getRarityLevel(rarityData, outputOpt.MinimumRarity)
+// handleRarity draws a piece, only considering the pieces accepted by allowed.
+// It reports false when no allowed piece exists in the drawn rarity levels
+func handleRarity(rng *rand.Rand, pieceTypes map[string]config.PieceAttribute, rarityData config.ConfigRarity, outputOpt config.OutputObject, allowed func(key string) bool) (string, config.PieceAttribute, bool) {
+	rarityLevel := getRarityLevel(rng, rarityData, outputOpt.MinimumRarity)
+	keys := make([]string, 0, len(pieceTypes))
+	for key := range pieceTypes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
 	var possiblePieces []string
 	for _, v := range rarityLevel {
-		for key, piece := range pieceTypes {
-			if v == piece.Rarity {
+		for _, key := range keys {
+			if v == pieceTypes[key].Rarity && (allowed == nil || allowed(key)) {
 				possiblePieces = append(possiblePieces, key)
 			}
 		}
@@ -80,10 +86,90 @@ func handleRarity(pieceTypes map[string]config.PieceAttribute, rarityData config
 		}
 	}
 
-	seed := time.Now().Unix() + int64(time.Now().Nanosecond())
-	rand.Seed(seed)
+	if len(possiblePieces) == 0 {
+		return "", config.PieceAttribute{}, false
+	}
+
+	choice := weightedChoice(rng, pieceTypes, possiblePieces)
+	return choice, pieceTypes[choice], true
+}
+
+func pieceWeight(piece config.PieceAttribute) float64 {
+	if piece.Weight <= 0 {
+		return 1
+	}
+	return piece.Weight
+}
+
+func weightedChoice(rng *rand.Rand, pieceTypes map[string]config.PieceAttribute, keys []string) string {
+	total := 0.0
+	for _, key := range keys {
+		total += pieceWeight(pieceTypes[key])
+	}
+	random := rng.Float64() * total
+	for _, key := range keys {
+		random -= pieceWeight(pieceTypes[key])
+		if random < 0 {
+			return key
+		}
+	}
+	return keys[len(keys)-1]
+}
+
+// attributeRarity returns the rarity table of an attribute, falling back to the global one
+func attributeRarity(c *config.Config, attribute string) config.ConfigRarity {
+	if rarity := c.Attributes[attribute].Rarity; len(rarity.Order) > 0 {
+		return rarity
+	}
+	return c.Settings.Rarity
+}
 
-	random := rand.Intn(len(possiblePieces))
-	choice := possiblePieces[random]
-	return choice, pieceTypes[choice]
+// plannedSamples is the number of tokens plannedShares plans at least, over as many collections as it takes
+const plannedSamples = 20000
+
+// plannedShares estimates the share of every piece in a collection of count tokens by planning whole
+// collections the way Generate does, with the rules, supplies and uniqueness redraws. At least twenty
+// collections are planned so the estimate is much closer than the counts of a single collection.
+// It returns the shares by attribute and the number of collections planned
+func plannedShares(c *config.Config, count int, seed int64) (map[string]map[string]float64, int, error) {
+	rules, err := compileRules(c)
+	if err != nil {
+		return nil, 0, err
+	}
+	collections := (plannedSamples + count - 1) / count
+	if collections < 20 {
+		collections = 20
+	}
+	quiet := func(string, ...interface{}) {}
+	counts := make(map[string]map[string]int, len(c.Settings.PieceOrder))
+	for _, attribute := range c.Settings.PieceOrder {
+		counts[attribute] = make(map[string]int)
+	}
+	planned := 0
+	for n := 0; n < collections; n++ {
+		plans, err := tryPlanTokens(c, rules, seed+int64(n)+1, count, 0, quiet)
+		if _, ok := err.(exhaustedError); ok {
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, plan := range plans {
+			for _, attribute := range c.Settings.PieceOrder {
+				counts[attribute][plan.selection[attribute]]++
+			}
+		}
+		planned++
+	}
+	if planned == 0 {
+		return nil, 0, fmt.Errorf("none of %d collections of %d tokens could be planned", collections, count)
+	}
+	shares := make(map[string]map[string]float64, len(counts))
+	for attribute, pieces := range counts {
+		shares[attribute] = make(map[string]float64, len(pieces))
+		for piece, n := range pieces {
+			shares[attribute][piece] = float64(n) / float64(planned*count)
+		}
+	}
+	return shares, planned, nil
 }
@@ -0,0 +1,385 @@
+package generator
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"sort"
+	"strings"
+
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+// suspiciousPValue is the p-value below which the piece counts of an attribute are flagged
+const suspiciousPValue = 0.01
+
+// Report compares a generated collection with collections planned from its config. Seed is nil when
+// the collection was read from its metadata files, which do not record it
+type Report struct {
+	Tokens      int
+	Seed        *int64
+	Planned     int
+	Attributes  []AttributeReport
+	Stats       []StatReport
+	TraitCounts []Bucket
+}
+
+// AttributeReport holds the piece counts of an attribute and a chi-squared goodness-of-fit test of
+// the counts against the expected shares of the pieces
+type AttributeReport struct {
+	Name             string
+	Pieces           []PieceCount
+	Tiers            []TierCount
+	ChiSquared       float64
+	DegreesOfFreedom int
+	PValue           float64
+	Suspicious       bool
+}
+
+type PieceCount struct {
+	Name     string
+	Rarity   string
+	Count    int
+	Actual   float64
+	Expected float64
+}
+
+// TierCount holds the tokens of a rarity tier. Configured is the chance of the tier in the rarity table of
+// the attribute, Expected its planned share as used by the chi-squared test
+type TierCount struct {
+	Tier       string
+	Count      int
+	Actual     float64
+	Configured float64
+	Expected   float64
+}
+
+type StatReport struct {
+	Name    string
+	Buckets []Bucket
+}
+
+// Bucket counts the tokens having a value, Share is relative to the largest bucket for drawing bars
+type Bucket struct {
+	Value int
+	Count int
+	Share float64
+}
+
+// BuildReport tallies the tokens of a manifest against the config it was generated with. Expected
+// shares come from planning collections of the same size, so rules, supplies and uniqueness redraws
+// shift the expectations the same way they shift the collection
+func BuildReport(config *conf.Config, manifest *Manifest) (*Report, error) {
+	count := len(manifest.Tokens)
+	if count == 0 {
+		return nil, fmt.Errorf("the manifest lists no tokens")
+	}
+	report := &Report{Tokens: count}
+	if !manifest.fromMeta {
+		report.Seed = &manifest.Seed
+	}
+	probabilities, planned, err := plannedShares(config, count, manifest.Seed)
+	if err != nil {
+		return nil, err
+	}
+	report.Planned = planned
+
+	traitCounts := make(map[int]int)
+	for _, token := range manifest.Tokens {
+		traitCounts[len(token.Selection)]++
+	}
+	report.TraitCounts = buckets(traitCounts)
+
+	for _, attribute := range config.Settings.PieceOrder {
+		counts := make(map[string]int)
+		for _, token := range manifest.Tokens {
+			piece, ok := token.Selection[attribute]
+			if !ok {
+				piece = emptyPiece
+			}
+			counts[piece]++
+		}
+		report.Attributes = append(report.Attributes, attributeReport(config, attribute, counts, probabilities[attribute], count))
+	}
+
+	stats := make([]string, 0, len(config.Settings.Stats))
+	for key := range config.Settings.Stats {
+		stats = append(stats, statName(config, key))
+	}
+	sort.Strings(stats)
+	for _, stat := range stats {
+		values := make(map[int]int)
+		for _, token := range manifest.Tokens {
+			if value, ok := token.Stats[stat]; ok {
+				values[value]++
+			}
+		}
+		if len(values) == 0 {
+			// stats are only recorded in the manifest when metadata is included
+			continue
+		}
+		report.Stats = append(report.Stats, StatReport{Name: stat, Buckets: buckets(values)})
+	}
+	return report, nil
+}
+
+func attributeReport(config *conf.Config, attribute string, counts map[string]int, probabilities map[string]float64, total int) AttributeReport {
+	report := AttributeReport{Name: attributeName(config, attribute)}
+	pieces := config.Attributes[attribute].Pieces
+	keys := make([]string, 0, len(pieces)+1)
+	for key := range pieces {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if counts[emptyPiece] > 0 || probabilities[emptyPiece] > 0 {
+		keys = append(keys, emptyPiece)
+	}
+
+	tiers := make(map[string]*TierCount)
+	var tierOrder []string
+	for _, key := range keys {
+		piece := PieceCount{
+			Name:     pieceName(config, attribute, key),
+			Rarity:   pieces[key].Rarity,
+			Count:    counts[key],
+			Actual:   float64(counts[key]) / float64(total),
+			Expected: probabilities[key],
+		}
+		if key == emptyPiece {
+			piece.Rarity = "empty"
+		}
+		report.Pieces = append(report.Pieces, piece)
+
+		tier, ok := tiers[piece.Rarity]
+		if !ok {
+			tier = &TierCount{Tier: piece.Rarity}
+			tiers[piece.Rarity] = tier
+			tierOrder = append(tierOrder, piece.Rarity)
+		}
+		tier.Count += piece.Count
+		tier.Actual += piece.Actual
+		tier.Expected += piece.Expected
+
+		if piece.Expected > 0 {
+			expected := piece.Expected * float64(total)
+			report.ChiSquared += math.Pow(float64(piece.Count)-expected, 2) / expected
+			report.DegreesOfFreedom++
+		} else if piece.Count > 0 {
+			report.Suspicious = true
+		}
+	}
+	report.DegreesOfFreedom--
+	report.PValue = 1
+	if report.DegreesOfFreedom > 0 {
+		report.PValue = chiSquaredPValue(report.ChiSquared, report.DegreesOfFreedom)
+	}
+	if report.PValue < suspiciousPValue {
+		report.Suspicious = true
+	}
+
+	rarity := attributeRarity(config, attribute)
+	emptyChance := config.Attributes[attribute].EmptyChance
+	if denominator := getRarityDenominator(rarity); denominator > 0 {
+		for name, tier := range tiers {
+			tier.Configured = (1 - emptyChance) * float64(rarity.Chances[name]) / float64(denominator)
+		}
+	}
+	if tier, ok := tiers["empty"]; ok {
+		tier.Configured = emptyChance
+	}
+
+	order := rarity.Order
+	sort.SliceStable(tierOrder, func(i, j int) bool {
+		return tierIndex(order, tierOrder[i]) < tierIndex(order, tierOrder[j])
+	})
+	for _, tier := range tierOrder {
+		report.Tiers = append(report.Tiers, *tiers[tier])
+	}
+	return report
+}
+
+// tierIndex orders tiers as configured, unknown tiers and empty pieces last
+func tierIndex(order []string, tier string) int {
+	for i, name := range order {
+		if name == tier {
+			return i
+		}
+	}
+	return len(order)
+}
+
+func buckets(counts map[int]int) []Bucket {
+	values := make([]int, 0, len(counts))
+	largest := 0
+	for value, count := range counts {
+		values = append(values, value)
+		if count > largest {
+			largest = count
+		}
+	}
+	sort.Ints(values)
+	result := make([]Bucket, 0, len(values))
+	for _, value := range values {
+		result = append(result, Bucket{Value: value, Count: counts[value], Share: float64(counts[value]) / float64(largest)})
+	}
+	return result
+}
+
+// chiSquaredPValue returns the chance of a chi-squared statistic at least as large as x with df degrees of freedom
+func chiSquaredPValue(x float64, df int) float64 {
+	return upperGamma(float64(df)/2, x/2)
+}
+
+// upperGamma is the regularized upper incomplete gamma function Q(a, x)
+func upperGamma(a float64, x float64) float64 {
+	if x <= 0 {
+		return 1
+	}
+	lgamma, _ := math.Lgamma(a)
+	prefix := math.Exp(-x + a*math.Log(x) - lgamma)
+	if x < a+1 {
+		// series of the lower incomplete gamma function
+		term := 1 / a
+		sum := term
+		for n := 1; n < 500; n++ {
+			term *= x / (a + float64(n))
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*1e-15 {
+				break
+			}
+		}
+		return 1 - sum*prefix
+	}
+	// continued fraction, modified Lentz's method
+	const tiny = 1e-300
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for i := 1; i < 500; i++ {
+		an := -float64(i) * (float64(i) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < 1e-15 {
+			break
+		}
+	}
+	return prefix * h
+}
+
+func percent(share float64) string {
+	return fmt.Sprintf("%.1f%%", share*100)
+}
+
+func bar(share float64, width int) string {
+	return strings.Repeat("█", int(math.Round(share*float64(width))))
+}
+
+// Markdown renders the report as Markdown
+func (r *Report) Markdown() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "# Collection report\n\n%d tokens", r.Tokens)
+	if r.Seed != nil {
+		fmt.Fprintf(&out, " generated with seed %d", *r.Seed)
+	}
+	fmt.Fprintf(&out, ". Planned shares come from planning %d collections of the same size with the same config, configured chances from its rarity tables.\n", r.Planned)
+
+	for _, attribute := range r.Attributes {
+		fmt.Fprintf(&out, "\n## %s\n\n", attribute.Name)
+		out.WriteString("| Piece | Rarity | Count | Actual | Planned |\n|---|---|---:|---:|---:|\n")
+		for _, piece := range attribute.Pieces {
+			fmt.Fprintf(&out, "| %s | %s | %d | %s | %s |\n", piece.Name, piece.Rarity, piece.Count, percent(piece.Actual), percent(piece.Expected))
+		}
+		out.WriteString("\n| Tier | Count | Actual | Configured | Planned |\n|---|---:|---:|---:|---:|\n")
+		for _, tier := range attribute.Tiers {
+			fmt.Fprintf(&out, "| %s | %d | %s | %s | %s |\n", tier.Tier, tier.Count, percent(tier.Actual), percent(tier.Configured), percent(tier.Expected))
+		}
+		fmt.Fprintf(&out, "\nChi-squared %.2f with %d degrees of freedom, p = %.4f", attribute.ChiSquared, attribute.DegreesOfFreedom, attribute.PValue)
+		if attribute.Suspicious {
+			out.WriteString(" **suspicious deviation from the planned shares**")
+		}
+		out.WriteString("\n")
+	}
+
+	for _, stat := range r.Stats {
+		fmt.Fprintf(&out, "\n## %s\n\n| Value | Count | |\n|---:|---:|---|\n", stat.Name)
+		for _, bucket := range stat.Buckets {
+			fmt.Fprintf(&out, "| %d | %d | %s |\n", bucket.Value, bucket.Count, bar(bucket.Share, 30))
+		}
+	}
+
+	out.WriteString("\n## Traits per token\n\n| Traits | Count | |\n|---:|---:|---|\n")
+	for _, bucket := range r.TraitCounts {
+		fmt.Fprintf(&out, "| %d | %d | %s |\n", bucket.Value, bucket.Count, bar(bucket.Share, 30))
+	}
+	return out.String()
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"percent": percent,
+	"width": func(share float64) string {
+		return fmt.Sprintf("%.1f%%", share*100)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Collection report</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 60em; color: #222; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { padding: 0.25em 0.75em; border-bottom: 1px solid #ddd; text-align: left; }
+td.number { text-align: right; }
+.bar { background: #4a7fd4; height: 1em; }
+.suspicious { color: #c0392b; font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>Collection report</h1>
+<p>{{.Tokens}} tokens{{with .Seed}} generated with seed {{.}}{{end}}. Planned shares come from planning {{.Planned}} collections of the same size with the same config, configured chances from its rarity tables.</p>
+{{range .Attributes}}
+<h2>{{.Name}}</h2>
+<table>
+<tr><th>Piece</th><th>Rarity</th><th>Count</th><th>Actual</th><th>Planned</th></tr>
+{{range .Pieces}}<tr><td>{{.Name}}</td><td>{{.Rarity}}</td><td class="number">{{.Count}}</td><td class="number">{{percent .Actual}}</td><td class="number">{{percent .Expected}}</td></tr>
+{{end}}</table>
+<table>
+<tr><th>Tier</th><th>Count</th><th>Actual</th><th>Configured</th><th>Planned</th></tr>
+{{range .Tiers}}<tr><td>{{.Tier}}</td><td class="number">{{.Count}}</td><td class="number">{{percent .Actual}}</td><td class="number">{{percent .Configured}}</td><td class="number">{{percent .Expected}}</td></tr>
+{{end}}</table>
+<p>Chi-squared {{printf "%.2f" .ChiSquared}} with {{.DegreesOfFreedom}} degrees of freedom, p = {{printf "%.4f" .PValue}}{{if .Suspicious}} <span class="suspicious">suspicious deviation from the planned shares</span>{{end}}</p>
+{{end}}
+{{range .Stats}}
+<h2>{{.Name}}</h2>
+<table>
+<tr><th>Value</th><th>Count</th><th></th></tr>
+{{range .Buckets}}<tr><td class="number">{{.Value}}</td><td class="number">{{.Count}}</td><td style="width: 20em"><div class="bar" style="width: {{width .Share}}"></div></td></tr>
+{{end}}</table>
+{{end}}
+<h2>Traits per token</h2>
+<table>
+<tr><th>Traits</th><th>Count</th><th></th></tr>
+{{range .TraitCounts}}<tr><td class="number">{{.Value}}</td><td class="number">{{.Count}}</td><td style="width: 20em"><div class="bar" style="width: {{width .Share}}"></div></td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// HTML renders the report as a self-contained HTML page
+func (r *Report) HTML() (string, error) {
+	var out strings.Builder
+	if err := reportTemplate.Execute(&out, r); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
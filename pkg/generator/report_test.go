@@ -0,0 +1,193 @@
+package generator
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+func TestPlannedSharesHonourSupplies(t *testing.T) {
+	config := testConfig(6)
+	config.Attributes["background"].Pieces["blue"] = conf.PieceAttribute{Rarity: "rare", ExactSupply: 3}
+	shares, planned, err := plannedShares(config, 6, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if planned < 20 {
+		t.Errorf("planned %d collections, want at least 20", planned)
+	}
+	if share := shares["background"]["blue"]; share != 0.5 {
+		t.Errorf("expected share of an exact supply of 3 in 6 tokens is %f, want 0.5", share)
+	}
+}
+
+func TestReportOfPlannedCollectionIsNotSuspicious(t *testing.T) {
+	config := testConfig(6)
+	config.Rules.Exclusions = []conf.ConfigExclusionRule{{Piece: "hat/crown", Excludes: []string{"background/dark", "background/green"}}}
+	rules, err := compileRules(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plans, err := planTokens(config, rules, 7, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := &Manifest{Seed: 7}
+	for _, plan := range plans {
+		token := ManifestToken{ID: plan.id, Selection: make(map[string]string)}
+		for attribute, piece := range plan.selection {
+			if piece != emptyPiece {
+				token.Selection[attribute] = piece
+			}
+		}
+		manifest.Tokens = append(manifest.Tokens, token)
+	}
+	report, err := BuildReport(config, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := make(map[string]float64)
+	for _, attribute := range report.Attributes {
+		if attribute.Suspicious {
+			t.Errorf("%s is flagged with p = %f although the collection was planned from the config", attribute.Name, attribute.PValue)
+		}
+		for _, piece := range attribute.Pieces {
+			expected[piece.Name] = piece.Expected
+		}
+	}
+	// the crown only goes with a blue background
+	if expected["Crown"] == 0 || expected["Crown"] > expected["Blue"] {
+		t.Errorf("expected share of the crown %f does not account for the exclusion, blue is %f", expected["Crown"], expected["Blue"])
+	}
+	if report.Seed == nil || *report.Seed != 7 {
+		t.Errorf("report seed %v, want 7", report.Seed)
+	}
+}
+
+func TestLoadManifestFromMetadataFiles(t *testing.T) {
+	dir := t.TempDir()
+	config := testConfig(3)
+	config.Output.IncludeMeta = true
+	config.Output.MetaFormat = conf.ERC1155
+	config.Output.ERC1155.Properties = true
+	config.Settings.Stats = map[string]conf.ConfigStat{"wit": {Name: "Wit"}}
+	documents := []map[string]interface{}{
+		{"Background": "Blue", "Headwear": "Baseball Cap", "Wit": 3},
+		{"Background": "Dark", "Headwear": "None", "Wit": 0},
+		{"Background": "Green", "Headwear": "Crown", "Wit": 1, "Type": "Green Crown"},
+	}
+	for i, properties := range documents {
+		data, err := json.Marshal(ERC1155Meta{Name: "token", Properties: properties})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, metaFilename(config.Output, i)), data, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifest, err := LoadManifest(config, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]string{
+		{"background": "blue", "hat": "cap"},
+		{"background": "dark"},
+		{"background": "green", "hat": "crown"},
+	}
+	if len(manifest.Tokens) != len(want) {
+		t.Fatalf("read %d tokens, want %d", len(manifest.Tokens), len(want))
+	}
+	for i, token := range manifest.Tokens {
+		if token.ID != i || len(token.Selection) != len(want[i]) {
+			t.Errorf("token %d: id %d, selection %v, want %v", i, token.ID, token.Selection, want[i])
+			continue
+		}
+		for attribute, piece := range want[i] {
+			if token.Selection[attribute] != piece {
+				t.Errorf("token %d: selection %v, want %v", i, token.Selection, want[i])
+			}
+		}
+		if token.Stats["Wit"] != documents[i]["Wit"] {
+			t.Errorf("token %d: stats %v", i, token.Stats)
+		}
+	}
+	if manifest.Tokens[2].Traits["Type"] != "Green Crown" {
+		t.Errorf("traits of token 2 are %v", manifest.Tokens[2].Traits)
+	}
+
+	report, err := BuildReport(config, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Seed != nil {
+		t.Errorf("report of metadata files has seed %d", *report.Seed)
+	}
+}
+
+func TestLoadManifestRejectsUnknownPieces(t *testing.T) {
+	dir := t.TempDir()
+	config := testConfig(1)
+	config.Output.IncludeMeta = true
+	config.Output.MetaFormat = conf.JSON
+	data, err := json.Marshal(OpenSeaMeta{Attributes: []OpenSeaAttribute{{TraitType: "Background", Value: "Purple"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "0.json"), data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadManifest(config, dir); err == nil {
+		t.Error("expected an error for a piece missing from the config")
+	}
+}
+
+func TestReportListsConfiguredTierChances(t *testing.T) {
+	config := testConfig(4)
+	config.Attributes["background"] = conf.ConfigPiece{
+		Rarity: conf.ConfigRarity{Order: []string{"common", "rare"}, Chances: map[string]int{"common": 3, "rare": 1}},
+		Pieces: config.Attributes["background"].Pieces,
+	}
+	manifest := &Manifest{Seed: 1, Tokens: []ManifestToken{
+		{ID: 0, Selection: map[string]string{"background": "dark", "hat": "cap"}},
+		{ID: 1, Selection: map[string]string{"background": "green", "hat": "crown"}},
+		{ID: 2, Selection: map[string]string{"background": "blue"}},
+		{ID: 3, Selection: map[string]string{"background": "dark", "hat": "cap"}},
+	}}
+	report, err := BuildReport(config, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[string]float64{
+		// the attribute's own rarity table
+		"Background": {"common": 0.75, "rare": 0.25},
+		// the global rarity table scaled by the empty chance of 0.25
+		"Headwear": {"common": 0.6, "rare": 0.15, "empty": 0.25},
+	}
+	for _, attribute := range report.Attributes {
+		if len(attribute.Tiers) != len(want[attribute.Name]) {
+			t.Errorf("%s: tiers %v", attribute.Name, attribute.Tiers)
+		}
+		for _, tier := range attribute.Tiers {
+			if math.Abs(tier.Configured-want[attribute.Name][tier.Tier]) > 1e-9 {
+				t.Errorf("%s/%s: configured chance %f, want %f", attribute.Name, tier.Tier, tier.Configured, want[attribute.Name][tier.Tier])
+			}
+		}
+	}
+
+	if markdown := report.Markdown(); !strings.Contains(markdown, "| Tier | Count | Actual | Configured | Planned |") || !strings.Contains(markdown, "| common | 3 | 75.0% | 75.0% |") {
+		t.Errorf("markdown tier table misses the configured chances:\n%s", markdown)
+	}
+	html, err := report.HTML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(html, "<th>Configured</th><th>Planned</th>") {
+		t.Error("html tier table misses the configured chances")
+	}
+}
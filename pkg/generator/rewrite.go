@@ -0,0 +1,264 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	conf "github.com/clickpop/looks/pkg/config"
+	"github.com/clickpop/looks/pkg/ipfs"
+)
+
+// MetaChange is the rewritten content of a json metadata file
+type MetaChange struct {
+	Path string
+	Old  []byte
+	New  []byte
+}
+
+// RewriteMeta sets a field of every json metadata file in the output directory from a template
+// using the placeholders of image-uri. Every other field is kept as generated, except for other
+// links to the same image which follow the image field. Only the files that change are returned,
+// nothing is written until ApplyMetaChanges
+func RewriteMeta(config *conf.Config, field string, template string) ([]MetaChange, error) {
+	dir := config.Output.Local.Directory
+	if dir == "" {
+		return nil, fmt.Errorf("output.local.directory is not set")
+	}
+	if !tokenMetaFiles(config.Output) {
+		return nil, fmt.Errorf("only metadata written as a json file per token can be rewritten, meta format is %q", config.Output.MetaFormat)
+	}
+	if _, err := metaField(newMetaDocument(config.Output), field); err != nil {
+		return nil, err
+	}
+	ids, err := metaFileIDs(config.Output, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	output := config.Output
+	output.IPFS = strings.Contains(template, "{cid}") || strings.Contains(template, "{image-cid}")
+	readImages := output.IPFS || strings.Contains(template, "{hash}")
+	files := make([]imageFile, len(ids))
+	for n, id := range ids {
+		files[n] = imageFile{filename: imageFilename(output, id)}
+		if !readImages {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, files[n].filename))
+		if err != nil {
+			return nil, err
+		}
+		files[n], err = describeImage(output, id, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var directory ipfs.Link
+	if output.IPFS {
+		links := make([]ipfs.Link, len(files))
+		for n, file := range files {
+			links[n] = file.cid
+		}
+		directory, err = ipfs.Directory(links, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var changes []MetaChange
+	for n, id := range ids {
+		path := filepath.Join(dir, metaFilename(config.Output, id))
+		old, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		meta := newMetaDocument(config.Output)
+		decoder := json.NewDecoder(bytes.NewReader(old))
+		decoder.UseNumber()
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(meta); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		value, _ := metaField(meta, field)
+		previous := *value
+		*value = uriPlaceholders(id, files[n], directory).Replace(template)
+		if field == ImageField(config.Output.MetaFormat) {
+			followImage(meta, previous, *value)
+		}
+		updated, err := json.MarshalIndent(meta, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(old, updated) {
+			changes = append(changes, MetaChange{Path: path, Old: old, New: updated})
+		}
+	}
+	return changes, nil
+}
+
+// metaFileIDs returns the token ids of the json metadata files in dir in ascending order
+func metaFileIDs(output conf.OutputObject, dir string) ([]int, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if id, ok := metaFileID(output, entry.Name()); ok {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no metadata files found in %s", dir)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// newMetaDocument returns the type the metadata files of the configured meta format decode to
+func newMetaDocument(output conf.OutputObject) interface{} {
+	switch output.MetaFormat {
+	case conf.Metaplex:
+		return &MetaplexMeta{}
+	case conf.TZIP21:
+		return &TZIP21Meta{}
+	case conf.ERC1155:
+		return &ERC1155Meta{}
+	}
+	return &OpenSeaMeta{}
+}
+
+// ImageField returns the name of the field linking to the image in the metadata of a meta format
+func ImageField(format conf.MetaFormat) string {
+	if format == conf.TZIP21 {
+		return "artifactUri"
+	}
+	return "image"
+}
+
+// followImage points the other links to the previous image of a document to the new one
+func followImage(meta interface{}, previous string, image string) {
+	follow := func(uri *string) {
+		if *uri == previous {
+			*uri = image
+		}
+	}
+	switch meta := meta.(type) {
+	case *MetaplexMeta:
+		for f := range meta.Properties.Files {
+			follow(&meta.Properties.Files[f].URI)
+		}
+	case *TZIP21Meta:
+		follow(&meta.DisplayURI)
+		follow(&meta.ThumbnailURI)
+		for f := range meta.Formats {
+			follow(&meta.Formats[f].URI)
+		}
+	}
+}
+
+// metaField returns the top level string field of the metadata with the given json name
+func metaField(meta interface{}, name string) (*string, error) {
+	value := reflect.ValueOf(meta).Elem()
+	var names []string
+	for i := 0; i < value.NumField(); i++ {
+		if value.Field(i).Kind() != reflect.String {
+			continue
+		}
+		tag := strings.Split(value.Type().Field(i).Tag.Get("json"), ",")[0]
+		if tag == name {
+			return value.Field(i).Addr().Interface().(*string), nil
+		}
+		names = append(names, tag)
+	}
+	return nil, fmt.Errorf("unknown metadata field %q, fields are %s", name, strings.Join(names, ", "))
+}
+
+// ApplyMetaChanges writes every change to a temporary file first and only replaces the
+// metadata files once all of them are written, each with an atomic rename
+func ApplyMetaChanges(changes []MetaChange) error {
+	temps := make([]string, 0, len(changes))
+	cleanup := func() {
+		for _, temp := range temps {
+			os.Remove(temp)
+		}
+	}
+	for _, change := range changes {
+		temp, err := ioutil.TempFile(filepath.Dir(change.Path), filepath.Base(change.Path)+".*.tmp")
+		if err != nil {
+			cleanup()
+			return err
+		}
+		temps = append(temps, temp.Name())
+		_, err = temp.Write(change.New)
+		if closeErr := temp.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Chmod(temp.Name(), 0666)
+		}
+		if err != nil {
+			cleanup()
+			return err
+		}
+	}
+	for n, change := range changes {
+		if err := os.Rename(temps[n], change.Path); err != nil {
+			cleanup()
+			return fmt.Errorf("%s: %w", change.Path, err)
+		}
+	}
+	return nil
+}
+
+// Diff returns the removed and added lines of the change
+func (c MetaChange) Diff() string {
+	old := strings.Split(string(c.Old), "\n")
+	updated := strings.Split(string(c.New), "\n")
+
+	// longest common subsequence of lines, metadata files are small
+	common := make([][]int, len(old)+1)
+	for i := range common {
+		common[i] = make([]int, len(updated)+1)
+	}
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(updated) - 1; j >= 0; j-- {
+			switch {
+			case old[i] == updated[j]:
+				common[i][j] = common[i+1][j+1] + 1
+			case common[i+1][j] >= common[i][j+1]:
+				common[i][j] = common[i+1][j]
+			default:
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	var diff strings.Builder
+	fmt.Fprintf(&diff, "--- %s\n+++ %s\n", c.Path, c.Path)
+	i, j := 0, 0
+	for i < len(old) || j < len(updated) {
+		switch {
+		case i < len(old) && j < len(updated) && old[i] == updated[j]:
+			i++
+			j++
+		case j >= len(updated) || (i < len(old) && common[i+1][j] >= common[i][j+1]):
+			fmt.Fprintf(&diff, "-%s\n", old[i])
+			i++
+		default:
+			fmt.Fprintf(&diff, "+%s\n", updated[j])
+			j++
+		}
+	}
+	return diff.String()
+}
@@ -0,0 +1,112 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// generateFiles writes the images and json metadata of the config and returns the metadata files by name
+func generateFiles(t *testing.T, count int) (*Generator, map[string][]byte) {
+	t.Helper()
+	config := renderConfig(t, count)
+	g, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Generate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return g, readFiles(t, config.Output.Local.Directory)
+}
+
+func TestRewriteMetaSetsField(t *testing.T) {
+	g, before := generateFiles(t, 3)
+	config := &g.config
+	changes, err := RewriteMeta(config, "external_url", "https://example.com/{id}?f={filename}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 3 {
+		t.Fatalf("%d changes, want one per metadata file", len(changes))
+	}
+	if after := readFiles(t, config.Output.Local.Directory); !reflect.DeepEqual(after, before) {
+		t.Error("files changed before the changes were applied")
+	}
+	if err := ApplyMetaChanges(changes); err != nil {
+		t.Fatal(err)
+	}
+	after := readFiles(t, config.Output.Local.Directory)
+	for i := 0; i < 3; i++ {
+		name := metaFilename(config.Output, i)
+		var old, updated OpenSeaMeta
+		if err := json.Unmarshal(before[name], &old); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(after[name], &updated); err != nil {
+			t.Fatal(err)
+		}
+		if want := "https://example.com/" + old.Name + "?f=" + imageFilename(config.Output, i); updated.ExternalURL != want {
+			t.Errorf("%s: external_url %q, want %q", name, updated.ExternalURL, want)
+		}
+		updated.ExternalURL = ""
+		if !reflect.DeepEqual(updated, old) {
+			t.Errorf("%s: other fields changed:\n%+v\nwant\n%+v", name, updated, old)
+		}
+	}
+
+	// applied changes leave nothing to rewrite
+	if changes, err := RewriteMeta(config, "external_url", "https://example.com/{id}?f={filename}"); err != nil || len(changes) != 0 {
+		t.Errorf("%d changes, %v after rewriting the same field twice", len(changes), err)
+	}
+}
+
+func TestRewriteMetaRejectsUnknownFields(t *testing.T) {
+	g, _ := generateFiles(t, 1)
+	for _, field := range []string{"colour", "attributes", "Image"} {
+		if _, err := RewriteMeta(&g.config, field, "x"); err == nil || !strings.Contains(err.Error(), "unknown metadata field") {
+			t.Errorf("%s: error %v, want an unknown field", field, err)
+		}
+	}
+}
+
+func TestMetaChangeDiff(t *testing.T) {
+	change := MetaChange{
+		Path: "0.json",
+		Old:  []byte("{\n  \"name\": \"0\",\n  \"image\": \"\"\n}"),
+		New:  []byte("{\n  \"name\": \"0\",\n  \"image\": \"ipfs://x/0.png\",\n  \"external_url\": \"y\"\n}"),
+	}
+	want := "--- 0.json\n+++ 0.json\n-  \"image\": \"\"\n+  \"image\": \"ipfs://x/0.png\",\n+  \"external_url\": \"y\"\n"
+	if got := change.Diff(); got != want {
+		t.Errorf("diff:\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestApplyMetaChangesWritesAllOrNothing(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "0.json")
+	if err := os.WriteFile(path, []byte("old"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	changes := []MetaChange{
+		{Path: path, Old: []byte("old"), New: []byte("new")},
+		{Path: filepath.Join(dir, "missing", "1.json"), Old: []byte("old"), New: []byte("new")},
+	}
+	if err := ApplyMetaChanges(changes); err == nil {
+		t.Fatal("expected an error writing to a missing directory")
+	}
+	if files := readFiles(t, dir); len(files) != 1 || string(files["0.json"]) != "old" {
+		t.Errorf("directory holds %v after a failed rewrite, want only the untouched 0.json", files)
+	}
+
+	if err := ApplyMetaChanges(changes[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if files := readFiles(t, dir); len(files) != 1 || string(files["0.json"]) != "new" {
+		t.Errorf("directory holds %v, want the rewritten 0.json and no temporary files", files)
+	}
+}
@@ -0,0 +1,263 @@
+package generator
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+// emptyPiece is the piece key used when an attribute has no layer for a token
+const emptyPiece = "nil"
+
+const maxSelectionAttempts = 1000
+
+type pieceRef struct {
+	attribute string
+	piece     string
+}
+
+func (p pieceRef) String() string {
+	return fmt.Sprintf("%s/%s", p.attribute, p.piece)
+}
+
+type ruleSet struct {
+	order    []string
+	excludes map[pieceRef][]pieceRef
+	requires map[pieceRef][][]pieceRef
+	empties  map[pieceRef][]string
+}
+
+func parsePieceRef(config *conf.Config, ref string) (pieceRef, error) {
+	parts := strings.SplitN(ref, "/", 2)
+	if len(parts) != 2 {
+		return pieceRef{}, fmt.Errorf("invalid piece reference %q, expected attribute/piece", ref)
+	}
+	p := pieceRef{attribute: parts[0], piece: parts[1]}
+	attribute, ok := config.Attributes[p.attribute]
+	if !ok {
+		return pieceRef{}, fmt.Errorf("unknown attribute %q in rule reference %q", p.attribute, ref)
+	}
+	if _, ok := attribute.Pieces[p.piece]; !ok && p.piece != emptyPiece {
+		return pieceRef{}, fmt.Errorf("unknown piece %q in rule reference %q", p.piece, ref)
+	}
+	return p, nil
+}
+
+func compileRules(config *conf.Config) (*ruleSet, error) {
+	rules := &ruleSet{
+		excludes: make(map[pieceRef][]pieceRef),
+		requires: make(map[pieceRef][][]pieceRef),
+		empties:  make(map[pieceRef][]string),
+	}
+
+	for _, rule := range config.Rules.Exclusions {
+		piece, err := parsePieceRef(config, rule.Piece)
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range rule.Excludes {
+			excluded, err := parsePieceRef(config, ref)
+			if err != nil {
+				return nil, err
+			}
+			rules.excludes[piece] = append(rules.excludes[piece], excluded)
+			rules.excludes[excluded] = append(rules.excludes[excluded], piece)
+		}
+	}
+
+	for _, rule := range config.Rules.Requirements {
+		piece, err := parsePieceRef(config, rule.Piece)
+		if err != nil {
+			return nil, err
+		}
+		var options []pieceRef
+		for _, ref := range rule.Requires {
+			required, err := parsePieceRef(config, ref)
+			if err != nil {
+				return nil, err
+			}
+			options = append(options, required)
+		}
+		if len(options) > 0 {
+			rules.requires[piece] = append(rules.requires[piece], options)
+		}
+	}
+
+	for _, rule := range config.Rules.Empty {
+		if _, ok := config.Attributes[rule.Attribute]; !ok {
+			return nil, fmt.Errorf("unknown attribute %q in empty rule", rule.Attribute)
+		}
+		piece, err := parsePieceRef(config, rule.When)
+		if err != nil {
+			return nil, err
+		}
+		rules.empties[piece] = append(rules.empties[piece], rule.Attribute)
+	}
+
+	order, err := selectionOrder(config.Settings.PieceOrder, rules.empties)
+	if err != nil {
+		return nil, err
+	}
+	rules.order = order
+
+	return rules, nil
+}
+
+// selectionOrder keeps the piece order but decides attributes that can empty
+// other attributes before the attributes they empty
+func selectionOrder(pieceOrder []string, empties map[pieceRef][]string) ([]string, error) {
+	after := make(map[string]map[string]bool)
+	for piece, attributes := range empties {
+		for _, attribute := range attributes {
+			if after[attribute] == nil {
+				after[attribute] = make(map[string]bool)
+			}
+			after[attribute][piece.attribute] = true
+		}
+	}
+
+	inOrder := make(map[string]bool)
+	for _, attribute := range pieceOrder {
+		inOrder[attribute] = true
+	}
+	order := make([]string, 0, len(pieceOrder))
+	placed := make(map[string]bool)
+	for len(order) < len(pieceOrder) {
+		progress := false
+		for _, attribute := range pieceOrder {
+			if placed[attribute] {
+				continue
+			}
+			ready := true
+			for dependency := range after[attribute] {
+				if inOrder[dependency] && !placed[dependency] && dependency != attribute {
+					ready = false
+				}
+			}
+			if ready {
+				order = append(order, attribute)
+				placed[attribute] = true
+				progress = true
+				break
+			}
+		}
+		if !progress {
+			return nil, fmt.Errorf("empty rules form a cycle between attributes")
+		}
+	}
+	return order, nil
+}
+
+// consistent reports if a partial selection can still satisfy every rule
+func (r *ruleSet) consistent(selection map[string]string) bool {
+	for attribute, piece := range selection {
+		ref := pieceRef{attribute: attribute, piece: piece}
+		for _, excluded := range r.excludes[ref] {
+			if selection[excluded.attribute] == excluded.piece {
+				return false
+			}
+		}
+		for _, options := range r.requires[ref] {
+			satisfiable := false
+			for _, required := range options {
+				chosen, decided := selection[required.attribute]
+				if !decided || chosen == required.piece {
+					satisfiable = true
+					break
+				}
+			}
+			if !satisfiable {
+				return false
+			}
+		}
+		for _, emptied := range r.empties[ref] {
+			if chosen, decided := selection[emptied]; decided && chosen != emptyPiece {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (r *ruleSet) forcesEmpty(selection map[string]string, attribute string) bool {
+	for chosen, piece := range selection {
+		for _, emptied := range r.empties[pieceRef{attribute: chosen, piece: piece}] {
+			if emptied == attribute {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *ruleSet) candidates(config *conf.Config, selection map[string]string, attribute string) []string {
+	if r.forcesEmpty(selection, attribute) {
+		return []string{emptyPiece}
+	}
+	pieces := make([]string, 0, len(config.Attributes[attribute].Pieces)+1)
+	for key := range config.Attributes[attribute].Pieces {
+		pieces = append(pieces, key)
+	}
+	if _, ok := config.Attributes[attribute].Pieces[emptyPiece]; !ok && config.Attributes[attribute].EmptyChance > 0 {
+		pieces = append(pieces, emptyPiece)
+	}
+	sort.Strings(pieces)
+	return pieces
+}
+
+// selectPieces picks a piece for every attribute in the piece order while honouring the rules and supplies
+func selectPieces(rng *rand.Rand, config *conf.Config, rules *ruleSet, supply *supplyTracker) (map[string]string, error) {
+	for attempt := 0; attempt < maxSelectionAttempts; attempt++ {
+		if selection, ok := trySelection(rng, config, rules, supply); ok {
+			return selection, nil
+		}
+	}
+	return nil, fmt.Errorf("no combination of pieces satisfying the rules and supplies was found after %d attempts", maxSelectionAttempts)
+}
+
+func trySelection(rng *rand.Rand, config *conf.Config, rules *ruleSet, supply *supplyTracker) (map[string]string, bool) {
+	selection := make(map[string]string)
+	for _, attribute := range rules.order {
+		forced, available := supply.draw(rng, config, attribute)
+		if rules.forcesEmpty(selection, attribute) {
+			if forced != "" {
+				return nil, false
+			}
+			selection[attribute] = emptyPiece
+			if !rules.consistent(selection) {
+				return nil, false
+			}
+			continue
+		}
+		if forced != "" {
+			selection[attribute] = forced
+			if !rules.consistent(selection) {
+				return nil, false
+			}
+			continue
+		}
+		if chance := config.Attributes[attribute].EmptyChance; chance > 0 && rng.Float64() < chance {
+			selection[attribute] = emptyPiece
+			if rules.consistent(selection) {
+				continue
+			}
+			delete(selection, attribute)
+		}
+		piece, _, ok := handleRarity(rng, config.Attributes[attribute].Pieces, attributeRarity(config, attribute), config.Output, func(key string) bool {
+			if !available(key) {
+				return false
+			}
+			selection[attribute] = key
+			defer delete(selection, attribute)
+			return rules.consistent(selection)
+		})
+		if !ok {
+			return nil, false
+		}
+		selection[attribute] = piece
+	}
+	return selection, true
+}
@@ -0,0 +1,76 @@
+package generator
+
+import (
+	"testing"
+
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+func TestSelectPiecesHonoursRules(t *testing.T) {
+	config := testConfig(1)
+	config.Settings.PieceOrder = []string{"background", "hat", "cape"}
+	config.Attributes["cape"] = conf.ConfigPiece{Pieces: map[string]conf.PieceAttribute{
+		"red":  {Rarity: "common"},
+		"gold": {Rarity: "rare"},
+	}}
+	config.Rules = conf.ConfigRules{
+		Exclusions:   []conf.ConfigExclusionRule{{Piece: "hat/crown", Excludes: []string{"background/dark"}}},
+		Requirements: []conf.ConfigRequirementRule{{Piece: "cape/gold", Requires: []string{"hat/crown", "background/blue"}}},
+		Empty:        []conf.ConfigEmptyRule{{Attribute: "cape", When: "hat/cap"}},
+	}
+	rules, err := compileRules(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the cape is decided after the hat that can empty it, although it comes later in the piece order anyway
+	if rules.order[2] != "cape" {
+		t.Errorf("selection order %v", rules.order)
+	}
+
+	supply, err := newSupplyTracker(config, 2000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for i := 0; i < 2000; i++ {
+		selection, err := selectPieces(tokenRand(1, i, 0), config, rules, supply)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[buildDNA(config, selection)] = true
+		if selection["hat"] == "crown" && selection["background"] == "dark" {
+			t.Errorf("%v: crown on a dark background", selection)
+		}
+		if selection["cape"] == "gold" && selection["hat"] != "crown" && selection["background"] != "blue" {
+			t.Errorf("%v: gold cape without a crown or a blue background", selection)
+		}
+		if selection["hat"] == "cap" && selection["cape"] != emptyPiece {
+			t.Errorf("%v: cape along with a cap", selection)
+		}
+	}
+	if want := countUniqueCombinations(config, rules, 100); len(seen) != want {
+		t.Errorf("drew %d combinations, the rules allow %d", len(seen), want)
+	}
+}
+
+func TestCompileRulesRejectsBadRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules conf.ConfigRules
+	}{
+		{"unknown attribute", conf.ConfigRules{Exclusions: []conf.ConfigExclusionRule{{Piece: "shoes/boot", Excludes: []string{"hat/cap"}}}}},
+		{"unknown piece", conf.ConfigRules{Requirements: []conf.ConfigRequirementRule{{Piece: "hat/cap", Requires: []string{"background/purple"}}}}},
+		{"missing attribute", conf.ConfigRules{Exclusions: []conf.ConfigExclusionRule{{Piece: "crown", Excludes: []string{"hat/cap"}}}}},
+		{"empty cycle", conf.ConfigRules{Empty: []conf.ConfigEmptyRule{
+			{Attribute: "hat", When: "background/blue"},
+			{Attribute: "background", When: "hat/cap"},
+		}}},
+	}
+	for _, test := range tests {
+		config := testConfig(1)
+		config.Rules = test.rules
+		if _, err := compileRules(config); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package generator
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+// simulateCombinationLimit caps the walk over every allowed combination, large trait spaces are only reported as exceeding it
+const simulateCombinationLimit = 1000000
+
+// Simulation is the outcome of drawing pieces many times without rendering anything
+type Simulation struct {
+	Draws      int
+	Failed     int
+	ImageCount int
+	Seed       int64
+	Attributes []SimulatedAttribute
+	// Planned is the number of collections planned for the expected shares
+	Planned int
+	// Distinct is the number of different combinations drawn, as counted for uniqueness
+	Distinct int
+	// Combinations is the number of unique combinations a collection can use under the rules and supplies,
+	// at most that many when combinations hold several capped pieces and at least when CombinationsCapped
+	Combinations       int
+	CombinationsCapped bool
+	// DuplicateChance is the chance of at least two of image-count draws picking the same combination,
+	// ExpectedDuplicates the expected number of such pairs. The generator draws again on every duplicate
+	DuplicateChance    float64
+	ExpectedDuplicates float64
+}
+
+type SimulatedAttribute struct {
+	Name   string
+	Pieces []SimulatedPiece
+}
+
+// SimulatedPiece compares the share of draws picking a piece with its share in collections planned from the config
+type SimulatedPiece struct {
+	Name     string
+	Rarity   string
+	Count    int
+	Share    float64
+	Expected float64
+}
+
+// Simulate runs the piece selection of the generator draws times, honouring the rules, minimum rarity
+// and supplies. Supplies are tracked as if the draws were consecutive collections of image-count tokens
+func Simulate(config *conf.Config, draws int) (*Simulation, error) {
+	if draws < 1 {
+		return nil, fmt.Errorf("at least one draw is needed, got %d", draws)
+	}
+	count := int(config.Output.ImageCount)
+	if count < 1 {
+		return nil, fmt.Errorf("output.image-count is not set")
+	}
+	rules, err := compileRules(config)
+	if err != nil {
+		return nil, err
+	}
+
+	sim := &Simulation{Draws: draws, ImageCount: count, Seed: collectionSeed(config)}
+	pieces := make(map[string]map[string]int, len(config.Settings.PieceOrder))
+	for _, attribute := range config.Settings.PieceOrder {
+		pieces[attribute] = make(map[string]int)
+	}
+	dnas := make(map[string]int)
+	var supply *supplyTracker
+	for i := 0; i < draws; i++ {
+		if i%count == 0 {
+			if supply, err = newSupplyTracker(config, count); err != nil {
+				return nil, err
+			}
+		}
+		selection, err := selectPieces(tokenRand(sim.Seed, i, 0), config, rules, supply)
+		if err != nil {
+			sim.Failed++
+			continue
+		}
+		supply.record(selection)
+		for _, attribute := range config.Settings.PieceOrder {
+			pieces[attribute][selection[attribute]]++
+		}
+		dnas[buildDNA(config, selection)]++
+	}
+	drawn := draws - sim.Failed
+	if drawn == 0 {
+		return nil, fmt.Errorf("none of the %d draws found a combination of pieces satisfying the rules and supplies", draws)
+	}
+
+	probabilities, planned, err := plannedShares(config, count, sim.Seed)
+	if err != nil {
+		return nil, err
+	}
+	sim.Planned = planned
+	for _, attribute := range config.Settings.PieceOrder {
+		result := SimulatedAttribute{Name: attributeName(config, attribute)}
+		keys := make([]string, 0, len(config.Attributes[attribute].Pieces)+1)
+		for key := range config.Attributes[attribute].Pieces {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		if pieces[attribute][emptyPiece] > 0 || probabilities[attribute][emptyPiece] > 0 {
+			keys = append(keys, emptyPiece)
+		}
+		for _, key := range keys {
+			piece := SimulatedPiece{
+				Name:     pieceName(config, attribute, key),
+				Rarity:   config.Attributes[attribute].Pieces[key].Rarity,
+				Count:    pieces[attribute][key],
+				Share:    float64(pieces[attribute][key]) / float64(drawn),
+				Expected: probabilities[attribute][key],
+			}
+			if key == emptyPiece {
+				piece.Rarity = "empty"
+			}
+			result.Pieces = append(result.Pieces, piece)
+		}
+		sim.Attributes = append(sim.Attributes, result)
+	}
+
+	sim.Distinct = len(dnas)
+	sim.Combinations = suppliedCombinations(config, rules, simulateCombinationLimit)
+	sim.CombinationsCapped = sim.Combinations >= simulateCombinationLimit
+
+	// birthday problem over the drawn combinations: the chance of two draws matching is estimated
+	// without bias from the counts, then spread over every pair of tokens in the collection
+	if drawn > 1 {
+		matching := 0.0
+		for _, n := range dnas {
+			matching += float64(n) * float64(n-1)
+		}
+		matching /= float64(drawn) * float64(drawn-1)
+		pairs := float64(count) * float64(count-1) / 2
+		sim.ExpectedDuplicates = pairs * matching
+		sim.DuplicateChance = 1 - math.Exp(-sim.ExpectedDuplicates)
+	}
+	return sim, nil
+}
+
+// suppliedCombinations counts the distinct DNAs allowed by the rules that a collection can use under the supplies,
+// stopping once limit DNAs are walked. Every combination holding a piece with a max or exact supply is counted
+// against the first such piece in the piece order, which takes at most its supply of them
+func suppliedCombinations(config *conf.Config, rules *ruleSet, limit int) int {
+	dnas := make(map[string]bool)
+	free := 0
+	capped := make(map[pieceRef]int)
+	walkCombinations(config, rules, func(selection map[string]string) bool {
+		dna := buildDNA(config, selection)
+		if dnas[dna] {
+			return true
+		}
+		dnas[dna] = true
+		if ref, ok := firstCappedPiece(config, selection); ok {
+			capped[ref]++
+		} else {
+			free++
+		}
+		return len(dnas) < limit
+	})
+	for ref, n := range capped {
+		piece := config.Attributes[ref.attribute].Pieces[ref.piece]
+		supply := piece.MaxSupply
+		if piece.ExactSupply > 0 {
+			supply = piece.ExactSupply
+		}
+		if n > supply {
+			n = supply
+		}
+		free += n
+	}
+	return free
+}
+
+func firstCappedPiece(config *conf.Config, selection map[string]string) (pieceRef, bool) {
+	for _, attribute := range config.Settings.PieceOrder {
+		key, ok := selection[attribute]
+		if !ok {
+			continue
+		}
+		if piece := config.Attributes[attribute].Pieces[key]; piece.MaxSupply > 0 || piece.ExactSupply > 0 {
+			return pieceRef{attribute: attribute, piece: key}, true
+		}
+	}
+	return pieceRef{}, false
+}
+
+// String formats the simulation as plain text tables
+func (s *Simulation) String() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "%d draws with seed %d", s.Draws, s.Seed)
+	if s.Failed > 0 {
+		fmt.Fprintf(&out, ", %d found no combination satisfying the rules and supplies", s.Failed)
+	}
+	fmt.Fprintf(&out, ". Expected shares come from planning %d collections of %d tokens with the same config.\n", s.Planned, s.ImageCount)
+
+	for _, attribute := range s.Attributes {
+		width := len("Piece")
+		for _, piece := range attribute.Pieces {
+			if len(piece.Name) > width {
+				width = len(piece.Name)
+			}
+		}
+		fmt.Fprintf(&out, "\n%s\n", attribute.Name)
+		fmt.Fprintf(&out, "  %-*s  %-10s  %8s  %8s\n", width, "Piece", "Rarity", "Drawn", "Expected")
+		for _, piece := range attribute.Pieces {
+			fmt.Fprintf(&out, "  %-*s  %-10s  %8s  %8s\n", width, piece.Name, piece.Rarity, percent(piece.Share), percent(piece.Expected))
+		}
+	}
+
+	out.WriteString("\n")
+	if s.CombinationsCapped {
+		fmt.Fprintf(&out, "Unique combinations available under the rules and supplies: more than %d\n", s.Combinations)
+	} else {
+		fmt.Fprintf(&out, "Unique combinations available under the rules and supplies: %d\n", s.Combinations)
+	}
+	fmt.Fprintf(&out, "Unique combinations drawn: %d\n", s.Distinct)
+	if s.Combinations < s.ImageCount {
+		fmt.Fprintf(&out, "Only %d unique combinations are available, %d images are requested\n", s.Combinations, s.ImageCount)
+		return out.String()
+	}
+	fmt.Fprintf(&out, "Chance of a duplicate draw in %d images: %s, %.1f expected\n", s.ImageCount, percent(s.DuplicateChance), s.ExpectedDuplicates)
+	return out.String()
+}
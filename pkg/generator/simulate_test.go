@@ -0,0 +1,110 @@
+package generator
+
+import (
+	"math"
+	"testing"
+
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+// simulatedPiece returns the simulated piece of an attribute by its name in the metadata
+func simulatedPiece(t *testing.T, sim *Simulation, attribute string, piece string) SimulatedPiece {
+	t.Helper()
+	for _, a := range sim.Attributes {
+		if a.Name != attribute {
+			continue
+		}
+		for _, p := range a.Pieces {
+			if p.Name == piece {
+				return p
+			}
+		}
+	}
+	t.Fatalf("no simulated piece %s/%s", attribute, piece)
+	return SimulatedPiece{}
+}
+
+func TestSimulateExpectsTheConstraintsOfTheDraws(t *testing.T) {
+	config := testConfig(6)
+	config.Attributes["background"].Pieces["blue"] = conf.PieceAttribute{Rarity: "rare", ExactSupply: 3}
+	config.Attributes["hat"].Pieces["crown"] = conf.PieceAttribute{Rarity: "rare", MaxSupply: 1}
+	config.Rules.Exclusions = []conf.ConfigExclusionRule{{Piece: "hat/cap", Excludes: []string{"background/green"}}}
+	sim, err := Simulate(config, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sim.Planned == 0 {
+		t.Fatal("no collection planned")
+	}
+	if blue := simulatedPiece(t, sim, "Background", "Blue"); math.Abs(blue.Expected-0.5) > 1e-9 {
+		t.Errorf("blue expected %f, want the exact supply of 3 in 6 tokens", blue.Expected)
+	}
+	if crown := simulatedPiece(t, sim, "Headwear", "Crown"); crown.Expected > 1.0/6+1e-9 || crown.Share > 1.0/6+1e-9 {
+		t.Errorf("crown expected %f and drawn %f, want at most the max supply of 1 in 6 tokens", crown.Expected, crown.Share)
+	}
+	// the exclusion removes caps from green backgrounds, so caps are expected less often than without rules
+	unruled := testConfig(6)
+	unruled.Attributes["background"].Pieces["blue"] = config.Attributes["background"].Pieces["blue"]
+	unruled.Attributes["hat"].Pieces["crown"] = config.Attributes["hat"].Pieces["crown"]
+	free, err := Simulate(unruled, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ruled, unruled := simulatedPiece(t, sim, "Headwear", "Baseball Cap"), simulatedPiece(t, free, "Headwear", "Baseball Cap"); ruled.Expected >= unruled.Expected {
+		t.Errorf("caps expected %f with the exclusion, %f without", ruled.Expected, unruled.Expected)
+	}
+}
+
+func TestSimulateCountsCombinationsUnderSupplies(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(config *conf.Config)
+		want   int
+	}{
+		{"no constraints", func(config *conf.Config) {}, 9},
+		// three backgrounds with a cap, a crown or nothing, but a single crown
+		{"max supply", func(config *conf.Config) {
+			config.Attributes["hat"].Pieces["crown"] = conf.PieceAttribute{Rarity: "rare", MaxSupply: 1}
+		}, 7},
+		{"exact supply", func(config *conf.Config) {
+			config.Attributes["hat"].Pieces["crown"] = conf.PieceAttribute{Rarity: "rare", ExactSupply: 2}
+		}, 8},
+		{"supply above the combinations", func(config *conf.Config) {
+			config.Attributes["hat"].Pieces["crown"] = conf.PieceAttribute{Rarity: "rare", MaxSupply: 5}
+		}, 9},
+		{"exclusion", func(config *conf.Config) {
+			config.Rules.Exclusions = []conf.ConfigExclusionRule{{Piece: "hat/crown", Excludes: []string{"background/dark"}}}
+		}, 8},
+		{"exclusion and max supply", func(config *conf.Config) {
+			config.Attributes["hat"].Pieces["crown"] = conf.PieceAttribute{Rarity: "rare", MaxSupply: 1}
+			config.Rules.Exclusions = []conf.ConfigExclusionRule{{Piece: "hat/crown", Excludes: []string{"background/dark"}}}
+		}, 7},
+	}
+	for _, test := range tests {
+		config := testConfig(4)
+		test.change(config)
+		sim, err := Simulate(config, 100)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if sim.Combinations != test.want || sim.CombinationsCapped {
+			t.Errorf("%s: %d combinations, capped %v, want %d", test.name, sim.Combinations, sim.CombinationsCapped, test.want)
+		}
+	}
+}
+
+func TestSimulateRejectsCollectionsAboveTheSupplies(t *testing.T) {
+	config := testConfig(7)
+	config.Attributes["hat"].Pieces["crown"] = conf.PieceAttribute{Rarity: "rare", MaxSupply: 1}
+	sim, err := Simulate(config, 70)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sim.Combinations != 7 {
+		t.Fatalf("%d combinations, want 7", sim.Combinations)
+	}
+	config.Output.ImageCount = 8
+	if _, err := Simulate(config, 80); err == nil {
+		t.Error("expected an error when no collection of 8 tokens can be planned")
+	}
+}
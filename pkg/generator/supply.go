@@ -0,0 +1,171 @@
+package generator
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/clickpop/looks/internal/utils"
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+// supplyTracker keeps count of the pieces used so far so max and exact supplies hold across the whole run
+type supplyTracker struct {
+	total  int
+	issued int
+	counts map[pieceRef]int
+}
+
+func newSupplyTracker(config *conf.Config, count int) (*supplyTracker, error) {
+	for _, attribute := range config.Settings.PieceOrder {
+		exact := 0
+		capped := 0
+		unlimited := config.Attributes[attribute].EmptyChance > 0
+		for key, piece := range config.Attributes[attribute].Pieces {
+			if piece.ExactSupply > 0 && piece.MaxSupply > 0 && piece.MaxSupply < piece.ExactSupply {
+				return nil, fmt.Errorf("piece %s/%s has an exact-supply of %d above its max-supply of %d", attribute, key, piece.ExactSupply, piece.MaxSupply)
+			}
+			switch {
+			case piece.ExactSupply > 0:
+				exact += piece.ExactSupply
+			case piece.MaxSupply > 0:
+				capped += piece.MaxSupply
+			default:
+				unlimited = true
+			}
+		}
+		if exact > count {
+			return nil, fmt.Errorf("exact supplies of attribute %s add up to %d, only %d images were requested", attribute, exact, count)
+		}
+		forced := forcedEmpty(config, attribute, count)
+		if exact > count-forced {
+			return nil, fmt.Errorf("exact supplies of attribute %s add up to %d, empty rules leave it empty on at least %d of %d images", attribute, exact, forced, count)
+		}
+		if !unlimited && exact+capped+forced < count {
+			return nil, fmt.Errorf("supplies of attribute %s only allow %d images, %d images were requested", attribute, exact+capped+forced, count)
+		}
+	}
+	return &supplyTracker{total: count, counts: make(map[pieceRef]int)}, nil
+}
+
+// forcedEmpty returns how many of count images at least have attribute emptied by the empty rules.
+// That is every image when each option of another attribute empties it, otherwise the exact
+// supplies of the pieces of the attribute emptying it the most
+func forcedEmpty(config *conf.Config, attribute string, count int) int {
+	triggers := make(map[string]map[string]bool)
+	emptied := make(map[string]bool)
+	for _, rule := range config.Rules.Empty {
+		emptied[rule.Attribute] = true
+		parts := strings.SplitN(rule.When, "/", 2)
+		if rule.Attribute != attribute || len(parts) != 2 {
+			continue
+		}
+		if triggers[parts[0]] == nil {
+			triggers[parts[0]] = make(map[string]bool)
+		}
+		triggers[parts[0]][parts[1]] = true
+	}
+	forced := 0
+	for trigger, pieces := range triggers {
+		if !utils.Contains(config.Settings.PieceOrder, trigger) {
+			continue
+		}
+		// an attribute that can be left empty only always empties when its empty piece does too
+		always := pieces[emptyPiece] || (config.Attributes[trigger].EmptyChance == 0 && !emptied[trigger])
+		n := 0
+		for key, piece := range config.Attributes[trigger].Pieces {
+			if pieces[key] {
+				n += piece.ExactSupply
+			} else {
+				always = false
+			}
+		}
+		if always {
+			n = count
+		}
+		if n > forced {
+			forced = n
+		}
+	}
+	return forced
+}
+
+func (s *supplyTracker) remaining() int {
+	return s.total - s.issued
+}
+
+// need returns how many more times a piece has to be used to meet its exact supply
+func (s *supplyTracker) need(attribute string, key string, piece conf.PieceAttribute) int {
+	if piece.ExactSupply == 0 {
+		return 0
+	}
+	return piece.ExactSupply - s.counts[pieceRef{attribute: attribute, piece: key}]
+}
+
+func (s *supplyTracker) available(attribute string, key string, piece conf.PieceAttribute) bool {
+	if piece.ExactSupply > 0 {
+		return false
+	}
+	return piece.MaxSupply == 0 || s.counts[pieceRef{attribute: attribute, piece: key}] < piece.MaxSupply
+}
+
+// draw decides if the next token has to take one of the pieces with an outstanding exact supply.
+// The outstanding supplies are spread over the remaining tokens so every quota is met by the end of the run
+func (s *supplyTracker) draw(rng *rand.Rand, config *conf.Config, attribute string) (string, func(key string) bool) {
+	pieces := config.Attributes[attribute].Pieces
+	keys := make([]string, 0, len(pieces))
+	for key := range pieces {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if remaining := s.remaining(); remaining > 0 {
+		slot := rng.Intn(remaining)
+		threshold := 0
+		for _, key := range keys {
+			threshold += s.need(attribute, key, pieces[key])
+			if slot < threshold {
+				return key, nil
+			}
+		}
+	}
+
+	return "", func(key string) bool {
+		return s.available(attribute, key, pieces[key])
+	}
+}
+
+// accepts reports if a complete selection fits the supplies left
+func (s *supplyTracker) accepts(config *conf.Config, selection map[string]string) bool {
+	for _, attribute := range config.Settings.PieceOrder {
+		pieces := config.Attributes[attribute].Pieces
+		outstanding := 0
+		for key, piece := range pieces {
+			outstanding += s.need(attribute, key, piece)
+		}
+		chosen := selection[attribute]
+		piece, ok := pieces[chosen]
+		if !ok {
+			if outstanding >= s.remaining() {
+				return false
+			}
+			continue
+		}
+		if piece.ExactSupply > 0 {
+			if s.need(attribute, chosen, piece) == 0 {
+				return false
+			}
+		} else if outstanding >= s.remaining() || !s.available(attribute, chosen, piece) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *supplyTracker) record(selection map[string]string) {
+	for attribute, piece := range selection {
+		s.counts[pieceRef{attribute: attribute, piece: piece}]++
+	}
+	s.issued++
+}
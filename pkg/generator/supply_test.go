@@ -0,0 +1,93 @@
+package generator
+
+import (
+	"testing"
+
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+func TestPlanTokensMeetsSupplies(t *testing.T) {
+	config := testConfig(6)
+	config.Attributes["background"].Pieces["blue"] = conf.PieceAttribute{Rarity: "rare", ExactSupply: 3}
+	config.Attributes["hat"].Pieces["cap"] = conf.PieceAttribute{Rarity: "common", MaxSupply: 2}
+	rules, err := compileRules(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for seed := int64(0); seed < 20; seed++ {
+		plans, err := planTokens(config, rules, seed, 6)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts := make(map[string]int)
+		for _, plan := range plans {
+			counts[plan.selection["background"]]++
+			counts[plan.selection["hat"]]++
+		}
+		if counts["blue"] != 3 {
+			t.Errorf("seed %d: %d blue backgrounds, want the exact supply of 3", seed, counts["blue"])
+		}
+		if counts["cap"] > 2 {
+			t.Errorf("seed %d: %d caps, want at most the max supply of 2", seed, counts["cap"])
+		}
+	}
+}
+
+func TestNewSupplyTrackerRejectsImpossibleSupplies(t *testing.T) {
+	tests := []struct {
+		name   string
+		pieces map[string]conf.PieceAttribute
+	}{
+		{"exact above max", map[string]conf.PieceAttribute{"dark": {ExactSupply: 3, MaxSupply: 2}, "blue": {}}},
+		{"exact above count", map[string]conf.PieceAttribute{"dark": {ExactSupply: 3}, "blue": {ExactSupply: 3}}},
+		{"capped below count", map[string]conf.PieceAttribute{"dark": {MaxSupply: 2}, "blue": {ExactSupply: 2}}},
+	}
+	for _, test := range tests {
+		config := testConfig(5)
+		config.Attributes["background"] = conf.ConfigPiece{Pieces: test.pieces}
+		if _, err := newSupplyTracker(config, 5); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+func TestNewSupplyTrackerAccountsForEmptyRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		cape     int
+		crown    int
+		when     []string
+		feasible bool
+	}{
+		{"room left by the crown", 4, 2, []string{"hat/crown"}, true},
+		{"crown takes the room of the cape", 5, 2, []string{"hat/crown"}, false},
+		{"some hats leave the cape", 3, 0, []string{"hat/crown", "hat/cap"}, true},
+		{"every hat empties the cape", 1, 0, []string{"hat/crown", "hat/cap", "hat/nil"}, false},
+	}
+	for _, test := range tests {
+		config := testConfig(6)
+		config.Settings.PieceOrder = []string{"background", "hat", "cape"}
+		config.Attributes["hat"].Pieces["crown"] = conf.PieceAttribute{Rarity: "rare", ExactSupply: test.crown}
+		config.Attributes["cape"] = conf.ConfigPiece{EmptyChance: 0.5, Pieces: map[string]conf.PieceAttribute{
+			"red": {Rarity: "common", ExactSupply: test.cape},
+		}}
+		for _, when := range test.when {
+			config.Rules.Empty = append(config.Rules.Empty, conf.ConfigEmptyRule{Attribute: "cape", When: when})
+		}
+		_, err := newSupplyTracker(config, 6)
+		if (err == nil) != test.feasible {
+			t.Errorf("%s: feasible %t, got %v", test.name, test.feasible, err)
+			continue
+		}
+		if !test.feasible {
+			continue
+		}
+		rules, err := compileRules(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := planTokens(config, rules, 1, 6); err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		}
+	}
+}
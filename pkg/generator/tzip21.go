@@ -0,0 +1,56 @@
+package generator
+
+import (
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+// TZIP21Meta is the TZIP-21 rich token metadata used on Tezos
+type TZIP21Meta struct {
+	Name            string            `json:"name"`
+	Symbol          string            `json:"symbol,omitempty"`
+	Description     string            `json:"description,omitempty"`
+	Decimals        int               `json:"decimals"`
+	IsBooleanAmount bool              `json:"isBooleanAmount"`
+	ArtifactURI     string            `json:"artifactUri"`
+	DisplayURI      string            `json:"displayUri"`
+	ThumbnailURI    string            `json:"thumbnailUri"`
+	ExternalURI     string            `json:"externalUri,omitempty"`
+	Formats         []TZIP21Format    `json:"formats"`
+	Creators        []string          `json:"creators"`
+	Attributes      []TZIP21Attribute `json:"attributes"`
+}
+
+type TZIP21Format struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType"`
+	FileSize int    `json:"fileSize,omitempty"`
+}
+
+type TZIP21Attribute struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+// tzip21Meta converts the metadata of a token to TZIP-21 as a single edition token
+func tzip21Meta(meta OpenSeaMeta, output conf.OutputObject, thumbnail string, file imageFile) TZIP21Meta {
+	if thumbnail == "" {
+		thumbnail = meta.Image
+	}
+	out := TZIP21Meta{
+		Name:            meta.Name,
+		Symbol:          output.Tezos.Symbol,
+		Description:     meta.Description,
+		IsBooleanAmount: true,
+		ArtifactURI:     meta.Image,
+		DisplayURI:      meta.Image,
+		ThumbnailURI:    thumbnail,
+		ExternalURI:     meta.ExternalURL,
+		Formats:         []TZIP21Format{{URI: meta.Image, MimeType: imageMimeType(output), FileSize: file.size}},
+		Creators:        append([]string{}, output.Tezos.Creators...),
+		Attributes:      make([]TZIP21Attribute, 0, len(meta.Attributes)),
+	}
+	for _, attribute := range meta.Attributes {
+		out.Attributes = append(out.Attributes, TZIP21Attribute{Name: attribute.TraitType, Value: attribute.Value})
+	}
+	return out
+}
@@ -0,0 +1,40 @@
+package generator
+
+import (
+	"encoding/json"
+	"testing"
+
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+func TestTZIP21Meta(t *testing.T) {
+	output := conf.OutputObject{MetaFormat: conf.TZIP21, ImageFormat: conf.WebP}
+	output.Tezos = conf.OutputTezos{Symbol: "RAT", Creators: []string{"tz1creator"}}
+	meta := OpenSeaMeta{
+		Name:        "7",
+		Image:       "ipfs://dir/7.webp",
+		ExternalURL: "https://example.com/7",
+		Attributes:  []OpenSeaAttribute{{TraitType: "Headwear", Value: "Crown"}},
+	}
+	file := imageFile{filename: "7.webp", size: 1234}
+	tests := []struct {
+		thumbnail string
+		want      string
+	}{
+		{"", "ipfs://dir/7.webp"},
+		{"ipfs://thumbs/7.webp", "ipfs://thumbs/7.webp"},
+	}
+	for _, test := range tests {
+		data, err := json.Marshal(tzip21Meta(meta, output, test.thumbnail, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `{"name":"7","symbol":"RAT","decimals":0,"isBooleanAmount":true,"artifactUri":"ipfs://dir/7.webp",` +
+			`"displayUri":"ipfs://dir/7.webp","thumbnailUri":"` + test.want + `","externalUri":"https://example.com/7",` +
+			`"formats":[{"uri":"ipfs://dir/7.webp","mimeType":"image/webp","fileSize":1234}],"creators":["tz1creator"],` +
+			`"attributes":[{"name":"Headwear","value":"Crown"}]}`
+		if string(data) != want {
+			t.Errorf("thumbnail %q:\n%s\nwant\n%s", test.thumbnail, data, want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package generator
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+const (
+	maxUniqueAttempts = 100
+	maxPlanAttempts   = 10
+	// maxRemainingWalk caps the combinations remainingCombination walks through for a single token
+	maxRemainingWalk = 1000000
+)
+
+// tokenPlan is the piece selection for a single token, decided before anything is rendered
+type tokenPlan struct {
+	id        int
+	dna       string
+	selection map[string]string
+	rng       *rand.Rand
+}
+
+// buildDNA identifies a selection by the chosen piece of every attribute that counts towards uniqueness
+func buildDNA(config *conf.Config, selection map[string]string) string {
+	parts := make([]string, 0, len(config.Settings.PieceOrder))
+	for _, attribute := range config.Settings.PieceOrder {
+		if config.Attributes[attribute].IgnoreUniqueness {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s:%s", attribute, selection[attribute]))
+	}
+	return strings.Join(parts, "|")
+}
+
+// planTokens selects a unique combination of pieces for every token in id order.
+// Planning starts over when it runs into a dead end, which can happen with tight supplies
+func planTokens(config *conf.Config, rules *ruleSet, seed int64, count int) ([]tokenPlan, error) {
+	var err error
+	for attempt := 0; attempt < maxPlanAttempts; attempt++ {
+		var plans []tokenPlan
+		plans, err = tryPlanTokens(config, rules, seed, count, attempt, log.Printf)
+		if err == nil {
+			return plans, nil
+		}
+		if _, ok := err.(exhaustedError); !ok {
+			return nil, err
+		}
+		log.Printf("Planning attempt %d failed: %s\n", attempt+1, err)
+	}
+	return nil, err
+}
+
+type exhaustedError struct {
+	id int
+}
+
+func (e exhaustedError) Error() string {
+	return fmt.Sprintf("trait space exhausted: no unique combination of pieces within the supplies left for image #%d", e.id)
+}
+
+// tryPlanTokens plans a collection once, reporting the tokens picked among the remaining combinations to logf
+func tryPlanTokens(config *conf.Config, rules *ruleSet, seed int64, count int, planAttempt int, logf func(format string, v ...interface{})) ([]tokenPlan, error) {
+	supply, err := newSupplyTracker(config, count)
+	if err != nil {
+		return nil, err
+	}
+	plans := make([]tokenPlan, 0, count)
+	seen := make(map[string]bool, count)
+	for i := 0; i < count; i++ {
+		rng := tokenRand(seed, i, planAttempt)
+		var selection map[string]string
+		dna := ""
+		for attempt := 0; attempt < maxUniqueAttempts && selection == nil; attempt++ {
+			candidate, err := selectPieces(rng, config, rules, supply)
+			if err != nil {
+				break
+			}
+			candidateDNA := buildDNA(config, candidate)
+			if !seen[candidateDNA] {
+				selection = candidate
+				dna = candidateDNA
+			}
+		}
+		if selection == nil {
+			logf("No unique combination drawn for image #%d, picking from the remaining combinations\n", i)
+			var capped bool
+			selection, capped = remainingCombination(rng, config, rules, supply, seen, maxRemainingWalk)
+			if selection == nil {
+				if capped {
+					logf("No remaining combination found for image #%d among the first %d combinations\n", i, maxRemainingWalk)
+				}
+				return nil, exhaustedError{id: i}
+			}
+			dna = buildDNA(config, selection)
+		}
+		seen[dna] = true
+		supply.record(selection)
+		plans = append(plans, tokenPlan{id: i, dna: dna, selection: selection, rng: rng})
+	}
+	return plans, nil
+}
+
+// walkCombinations calls fn with every complete selection allowed by the rules until fn returns false
+func walkCombinations(config *conf.Config, rules *ruleSet, fn func(selection map[string]string) bool) {
+	selection := make(map[string]string)
+	var walk func(depth int) bool
+	walk = func(depth int) bool {
+		if depth == len(rules.order) {
+			return fn(selection)
+		}
+		attribute := rules.order[depth]
+		for _, piece := range rules.candidates(config, selection, attribute) {
+			selection[attribute] = piece
+			keepGoing := true
+			if rules.consistent(selection) {
+				keepGoing = walk(depth + 1)
+			}
+			delete(selection, attribute)
+			if !keepGoing {
+				return false
+			}
+		}
+		return true
+	}
+	walk(0)
+}
+
+// countUniqueCombinations counts the distinct DNAs allowed by the rules, stopping once limit is reached
+func countUniqueCombinations(config *conf.Config, rules *ruleSet, limit int) int {
+	dnas := make(map[string]bool)
+	walkCombinations(config, rules, func(selection map[string]string) bool {
+		dnas[buildDNA(config, selection)] = true
+		return len(dnas) < limit
+	})
+	return len(dnas)
+}
+
+// remainingCombination picks uniformly among the allowed combinations whose DNA has not been used yet.
+// The walk stops after limit combinations so large trait spaces cannot stall planning, the pick is then
+// among the combinations walked and capped is set
+func remainingCombination(rng *rand.Rand, config *conf.Config, rules *ruleSet, supply *supplyTracker, seen map[string]bool, limit int) (map[string]string, bool) {
+	var choice map[string]string
+	found, walked := 0, 0
+	walkCombinations(config, rules, func(selection map[string]string) bool {
+		walked++
+		if seen[buildDNA(config, selection)] || !supply.accepts(config, selection) {
+			return walked < limit
+		}
+		found++
+		if rng.Intn(found) == 0 {
+			choice = make(map[string]string, len(selection))
+			for k, v := range selection {
+				choice[k] = v
+			}
+		}
+		return walked < limit
+	})
+	return choice, walked >= limit
+}
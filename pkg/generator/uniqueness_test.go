@@ -0,0 +1,54 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+	"testing"
+
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+func TestRemainingCombinationStopsAtLimit(t *testing.T) {
+	config := testConfig(9)
+	rules, err := compileRules(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	supply, err := newSupplyTracker(config, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	var last string
+	walkCombinations(config, rules, func(selection map[string]string) bool {
+		last = buildDNA(config, selection)
+		seen[last] = true
+		return true
+	})
+	delete(seen, last)
+
+	if selection, capped := remainingCombination(rand.New(rand.NewSource(1)), config, rules, supply, seen, 100); buildDNA(config, selection) != last || capped {
+		t.Errorf("picked %v, capped %t, want the only remaining combination %s", selection, capped, last)
+	}
+	if selection, capped := remainingCombination(rand.New(rand.NewSource(1)), config, rules, supply, seen, 3); selection != nil || !capped {
+		t.Errorf("picked %v, capped %t, want nothing once the limit is reached", selection, capped)
+	}
+}
+
+func TestExhaustedPlanWritesNothing(t *testing.T) {
+	// nine combinations, but with a single crown only seven can be used
+	config := renderConfig(t, 9)
+	config.Attributes["hat"].Pieces["crown"] = conf.PieceAttribute{Rarity: "rare", MaxSupply: 1}
+	g, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Generate(context.Background()); !errors.As(err, &exhaustedError{}) {
+		t.Fatalf("error %v, want planning to run out of combinations", err)
+	}
+	if _, err := os.Stat(config.Output.Local.Directory); !os.IsNotExist(err) {
+		t.Errorf("output directory exists after a failed plan: %v", err)
+	}
+}
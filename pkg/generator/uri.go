@@ -0,0 +1,61 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	conf "github.com/clickpop/looks/pkg/config"
+	"github.com/clickpop/looks/pkg/ipfs"
+)
+
+// imageFile describes the image file of a token for the link templates
+type imageFile struct {
+	filename string
+	size     int
+	hash     string
+	cid      ipfs.Link
+}
+
+func describeImage(output conf.OutputObject, i int, imageData []byte) (imageFile, error) {
+	sum := sha256.Sum256(imageData)
+	file := imageFile{filename: imageFilename(output, i), size: len(imageData), hash: hex.EncodeToString(sum[:])}
+	if ipfsEnabled(output) {
+		link, err := ipfs.File(imageData, nil)
+		if err != nil {
+			return imageFile{}, err
+		}
+		link.Name = file.filename
+		file.cid = link
+	}
+	return file, nil
+}
+
+// uriPlaceholders replaces the placeholders of the image-uri and external-url templates.
+// {hash} is the sha256 of the image file as written, {cid} and {image-cid} are only filled in
+// when ipfs is enabled. Other placeholders are left as is
+func uriPlaceholders(i int, file imageFile, directory ipfs.Link) *strings.Replacer {
+	replacements := []string{
+		"{id}", fmt.Sprint(i),
+		"{hex-id}", fmt.Sprintf("%064x", i),
+		"{filename}", file.filename,
+		"{hash}", file.hash,
+	}
+	if directory.CID.Defined() {
+		replacements = append(replacements, "{cid}", directory.CID.String(), "{image-cid}", file.cid.CID.String())
+	}
+	return strings.NewReplacer(replacements...)
+}
+
+// imageURI returns the image link of a token: the image-uri template when set, otherwise
+// the image filename appended to the base-uri. Without either the link is left empty
+func imageURI(output conf.OutputObject, i int, placeholders *strings.Replacer) string {
+	if output.ImageURI != "" {
+		return placeholders.Replace(output.ImageURI)
+	}
+	if output.BaseURI == "" {
+		return ""
+	}
+	return strings.TrimSuffix(output.BaseURI, "/") + "/" + imageFilename(output, i)
+}
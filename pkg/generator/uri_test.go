@@ -0,0 +1,57 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	conf "github.com/clickpop/looks/pkg/config"
+	"github.com/clickpop/looks/pkg/ipfs"
+)
+
+func TestURIPlaceholders(t *testing.T) {
+	output := conf.OutputObject{IPFS: true}
+	file, err := describeImage(output, 10, []byte("looks\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	directory, err := ipfs.Directory([]ipfs.Link{file.cid}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := "{id} {hex-id} {filename} {hash} {cid} {image-cid} {other}"
+	want := fmt.Sprintf("10 %s 10.png bf1d76b4993bd8d9f48d6bf626e80bd9193da0b7f463444b91c751550562476e %s %s {other}",
+		strings.Repeat("0", 63)+"a", directory.CID, "bafkreif7dv3ljgj33dm7jdll6ytoqc6zde62bn7umncexeohkfkqkyshny")
+	if got := uriPlaceholders(10, file, directory).Replace(template); got != want {
+		t.Errorf("with ipfs:\n%s\nwant\n%s", got, want)
+	}
+
+	// the CIDs are left in place without ipfs
+	file, err = describeImage(conf.OutputObject{}, 10, []byte("looks\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := uriPlaceholders(10, file, ipfs.Link{}).Replace("{filename} {cid} {image-cid}"); got != "10.png {cid} {image-cid}" {
+		t.Errorf("without ipfs: %s", got)
+	}
+}
+
+func TestImageURI(t *testing.T) {
+	file := imageFile{filename: "3.png", hash: "abc"}
+	tests := []struct {
+		baseURI  string
+		imageURI string
+		want     string
+	}{
+		{"", "", ""},
+		{"https://example.com/images", "", "https://example.com/images/3.png"},
+		{"https://example.com/images/", "", "https://example.com/images/3.png"},
+		{"https://example.com/images", "ar://{hash}", "ar://abc"},
+	}
+	for _, test := range tests {
+		output := conf.OutputObject{BaseURI: test.baseURI, ImageURI: test.imageURI}
+		if got := imageURI(output, 3, uriPlaceholders(3, file, ipfs.Link{})); got != test.want {
+			t.Errorf("base-uri %q, image-uri %q: %q, want %q", test.baseURI, test.imageURI, got, test.want)
+		}
+	}
+}
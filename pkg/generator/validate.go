@@ -0,0 +1,455 @@
+package generator
+
+import (
+	"fmt"
+	"image/png"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/clickpop/looks/internal/utils"
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+// ValidationProblem is a single issue found in a config, located by its JSON path
+type ValidationProblem struct {
+	Path    string
+	Message string
+}
+
+func (p ValidationProblem) String() string {
+	return fmt.Sprintf("%s: %s", p.Path, p.Message)
+}
+
+type validator struct {
+	config   *conf.Config
+	problems []ValidationProblem
+}
+
+func (v *validator) add(path string, format string, args ...interface{}) {
+	v.problems = append(v.problems, ValidationProblem{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+var formatVerb = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z]`)
+
+var (
+	solanaAddress = regexp.MustCompile(`^[1-9A-HJ-NP-Za-km-z]{32,44}$`)
+	tezosAddress  = regexp.MustCompile(`^(tz[1-4]|KT1)[1-9A-HJ-NP-Za-km-z]{33}$`)
+	policyID      = regexp.MustCompile(`^[0-9a-f]{56}$`)
+)
+
+func countFormatVerbs(template string) int {
+	return len(formatVerb.FindAllString(strings.ReplaceAll(template, "%%", ""), -1))
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	for _, key := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Validate checks a config and the piece files it references, returning every problem found
+func Validate(config *conf.Config) []ValidationProblem {
+	v := &validator{config: config}
+	v.validateInput()
+	v.validatePieceOrder()
+	v.validateRarity("$.settings.rarity", config.Settings.Rarity, true)
+	v.validateStats()
+	v.validateCustomAttributes()
+	v.validateAttributes()
+	v.validatePieceFiles()
+	v.validateRules()
+	v.validateDescriptions()
+	v.validateOutput()
+	return v.problems
+}
+
+func (v *validator) validateInput() {
+	if countFormatVerbs(v.config.Input.Local.Filename) != 2 {
+		v.add("$.input.local.filename", "filename %q needs two placeholders, one for the attribute and one for the piece", v.config.Input.Local.Filename)
+	}
+	if info, err := os.Stat(v.config.Input.Local.Pathname); err != nil || !info.IsDir() {
+		v.add("$.input.local.pathname", "directory %q does not exist", v.config.Input.Local.Pathname)
+	}
+}
+
+func (v *validator) validatePieceOrder() {
+	if len(v.config.Settings.PieceOrder) == 0 {
+		v.add("$.settings.piece-order", "no attributes in piece order")
+	}
+	seen := make(map[string]bool)
+	for i, attribute := range v.config.Settings.PieceOrder {
+		path := fmt.Sprintf("$.settings.piece-order[%d]", i)
+		if _, ok := v.config.Attributes[attribute]; !ok {
+			v.add(path, "attribute %q does not exist in attributes", attribute)
+		}
+		if seen[attribute] {
+			v.add(path, "attribute %q is listed more than once", attribute)
+		}
+		seen[attribute] = true
+	}
+}
+
+func (v *validator) validateRarity(path string, rarity conf.ConfigRarity, required bool) {
+	if len(rarity.Order) == 0 {
+		if required {
+			v.add(path+".order", "no rarity levels defined")
+		}
+		return
+	}
+	inOrder := make(map[string]bool)
+	for i, level := range rarity.Order {
+		if inOrder[level] {
+			v.add(fmt.Sprintf("%s.order[%d]", path, i), "rarity %q is listed more than once", level)
+		}
+		inOrder[level] = true
+		if _, ok := rarity.Chances[level]; !ok {
+			v.add(fmt.Sprintf("%s.order[%d]", path, i), "rarity %q has no chance", level)
+		}
+	}
+	for _, level := range sortedKeys(rarity.Chances) {
+		if rarity.Chances[level] <= 0 {
+			v.add(fmt.Sprintf("%s.chances.%s", path, level), "chance must be positive, got %d", rarity.Chances[level])
+		}
+		if !inOrder[level] {
+			v.add(fmt.Sprintf("%s.chances.%s", path, level), "rarity %q is not in the rarity order", level)
+		}
+	}
+	if minimum := v.config.Output.MinimumRarity; minimum != "" && path == "$.settings.rarity" && !inOrder[minimum] {
+		v.add("$.output.minimum-rarity", "rarity %q is not in the rarity order", minimum)
+	}
+}
+
+func (v *validator) validateStats() {
+	for _, key := range sortedKeys(v.config.Settings.Stats) {
+		stat := v.config.Settings.Stats[key]
+		if stat.Minimum > stat.Maximum {
+			v.add(fmt.Sprintf("$.settings.stats.%s", key), "minimum %d is above maximum %d", stat.Minimum, stat.Maximum)
+		}
+	}
+}
+
+func (v *validator) validateCustomAttributes() {
+	for _, key := range sortedKeys(v.config.Settings.Attributes) {
+		if err := checkTimestamp(v.config.Settings.Attributes[key]); err != nil {
+			v.add(fmt.Sprintf("$.settings.attributes.%s.value", key), "%s", err)
+		}
+	}
+}
+
+func (v *validator) validateAttributes() {
+	for _, attribute := range sortedKeys(v.config.Attributes) {
+		path := fmt.Sprintf("$.attributes.%s", attribute)
+		configPiece := v.config.Attributes[attribute]
+		v.validateRarity(path+".rarity", configPiece.Rarity, false)
+		rarity := attributeRarity(v.config, attribute)
+		levels := make(map[string]bool)
+		for _, level := range rarity.Order {
+			levels[level] = true
+		}
+		if configPiece.EmptyChance < 0 || configPiece.EmptyChance > 1 {
+			v.add(path+".empty-chance", "empty chance must be between 0 and 1, got %g", configPiece.EmptyChance)
+		}
+		if len(configPiece.Pieces) == 0 {
+			v.add(path+".pieces", "attribute has no pieces")
+		}
+		for _, key := range sortedKeys(configPiece.Pieces) {
+			piecePath := fmt.Sprintf("%s.pieces.%s", path, key)
+			piece := configPiece.Pieces[key]
+			if piece.ExactSupply == 0 && !levels[piece.Rarity] {
+				v.add(piecePath+".rarity", "rarity %q is not in the rarity order", piece.Rarity)
+			}
+			if piece.Weight < 0 {
+				v.add(piecePath+".weight", "weight must not be negative, got %g", piece.Weight)
+			}
+			if piece.MaxSupply < 0 {
+				v.add(piecePath+".max-supply", "max supply must not be negative, got %d", piece.MaxSupply)
+			}
+			if piece.ExactSupply < 0 {
+				v.add(piecePath+".exact-supply", "exact supply must not be negative, got %d", piece.ExactSupply)
+			}
+			for _, stat := range sortedKeys(piece.Stats) {
+				if _, ok := v.config.Settings.Stats[stat]; !ok {
+					v.add(fmt.Sprintf("%s.stats.%s", piecePath, stat), "stat %q does not exist in settings.stats", stat)
+				}
+			}
+		}
+	}
+}
+
+func (v *validator) validatePieceFiles() {
+	width, height := 0, 0
+	reference := ""
+	for _, attribute := range v.config.Settings.PieceOrder {
+		for _, key := range sortedKeys(v.config.Attributes[attribute].Pieces) {
+			if key == emptyPiece {
+				continue
+			}
+			path := fmt.Sprintf("$.attributes.%s.pieces.%s", attribute, key)
+			file := piecePath(v.config, attribute, key)
+			f, err := os.Open(file)
+			if err != nil {
+				v.add(path, "piece file %s can not be opened: %s", file, err)
+				continue
+			}
+			img, err := png.Decode(f)
+			f.Close()
+			if err != nil {
+				v.add(path, "piece file %s is not a valid png: %s", file, err)
+				continue
+			}
+			bounds := img.Bounds()
+			if reference == "" {
+				width, height = bounds.Dx(), bounds.Dy()
+				reference = file
+			} else if bounds.Dx() != width || bounds.Dy() != height {
+				v.add(path, "piece file %s is %dx%d, expected %dx%d like %s", file, bounds.Dx(), bounds.Dy(), width, height, reference)
+			}
+		}
+	}
+}
+
+func (v *validator) validateRules() {
+	before := len(v.problems)
+	check := func(path string, ref string) {
+		if _, err := parsePieceRef(v.config, ref); err != nil {
+			v.add(path, "%s", err)
+		}
+	}
+	for i, rule := range v.config.Rules.Exclusions {
+		check(fmt.Sprintf("$.rules.exclusions[%d].piece", i), rule.Piece)
+		for j, ref := range rule.Excludes {
+			check(fmt.Sprintf("$.rules.exclusions[%d].excludes[%d]", i, j), ref)
+		}
+	}
+	for i, rule := range v.config.Rules.Requirements {
+		check(fmt.Sprintf("$.rules.requirements[%d].piece", i), rule.Piece)
+		if len(rule.Requires) == 0 {
+			v.add(fmt.Sprintf("$.rules.requirements[%d].requires", i), "no required pieces listed")
+		}
+		for j, ref := range rule.Requires {
+			check(fmt.Sprintf("$.rules.requirements[%d].requires[%d]", i, j), ref)
+		}
+	}
+	for i, rule := range v.config.Rules.Empty {
+		if _, ok := v.config.Attributes[rule.Attribute]; !ok {
+			v.add(fmt.Sprintf("$.rules.empty[%d].attribute", i), "attribute %q does not exist in attributes", rule.Attribute)
+		}
+		check(fmt.Sprintf("$.rules.empty[%d].when", i), rule.When)
+	}
+	if len(v.problems) == before {
+		if _, err := compileRules(v.config); err != nil {
+			v.add("$.rules", "%s", err)
+		}
+	}
+}
+
+func (v *validator) validateDescriptions() {
+	d := v.config.Descriptions
+	switch {
+	case len(d.SimpleFragments) > 0:
+		if n := countFormatVerbs(d.Template); n != 1 {
+			v.add("$.descriptions.template", "template for simple fragments needs one placeholder, found %d", n)
+		}
+		if d.FragmentCount <= 0 {
+			v.add("$.descriptions.fragment-count", "fragment count must be positive, got %d", d.FragmentCount)
+		}
+		for i, fragment := range d.SimpleFragments {
+			if strings.TrimSpace(fragment) == "" {
+				v.add(fmt.Sprintf("$.descriptions.simple-fragments[%d]", i), "fragment is empty")
+			}
+		}
+	case d.StatFragments != nil:
+		if n := countFormatVerbs(d.Template); n != 3 {
+			v.add("$.descriptions.template", "template for stat fragments needs three placeholders for type, descriptor and hobbies, found %d", n)
+		}
+		for _, key := range sortedKeys(d.StatFragments) {
+			path := fmt.Sprintf("$.descriptions.stat-fragments.%s", key)
+			if _, ok := v.config.Settings.Stats[key]; !ok && key != "fallback" {
+				v.add(path, "stat %q does not exist in settings.stats", key)
+			}
+			if len(d.StatFragments[key].Descriptors) == 0 {
+				v.add(path+".descriptors", "no descriptors listed")
+			}
+			if len(d.StatFragments[key].Hobbies) == 0 {
+				v.add(path+".hobbies", "no hobbies listed")
+			}
+		}
+		if d.FallbackPrimaryStat != "" && !v.resolvesToStatFragment(d.FallbackPrimaryStat) {
+			v.add("$.descriptions.fallback-primary-stat", "%q does not match a stat name with stat fragments", d.FallbackPrimaryStat)
+		}
+	}
+}
+
+// resolvesToStatFragment mirrors the lookup buildStatDescription does for the primary stat
+func (v *validator) resolvesToStatFragment(name string) bool {
+	if name == "fallback" {
+		_, ok := v.config.Descriptions.StatFragments["fallback"]
+		return ok
+	}
+	for key := range v.config.Settings.Stats {
+		if statName(v.config, key) == name {
+			_, ok := v.config.Descriptions.StatFragments[key]
+			return ok
+		}
+	}
+	return false
+}
+
+// validateMetaplex checks the collection-level fields against the limits of the Metaplex token metadata program
+func (v *validator) validateMetaplex() {
+	metaplex := v.config.Output.Metaplex
+	if len(metaplex.Symbol) > 10 {
+		v.add("$.output.metaplex.symbol", "symbol can be at most 10 characters, got %q", metaplex.Symbol)
+	}
+	if fee := metaplex.SellerFeeBasisPoints; fee < 0 || fee > 10000 {
+		v.add("$.output.metaplex.seller-fee-basis-points", "seller fee must be between 0 and 10000 basis points, got %d", fee)
+	}
+	if len(metaplex.Creators) == 0 {
+		v.add("$.output.metaplex.creators", "at least one creator is required")
+		return
+	}
+	if len(metaplex.Creators) > 5 {
+		v.add("$.output.metaplex.creators", "at most 5 creators are allowed, got %d", len(metaplex.Creators))
+	}
+	total := 0
+	for n, creator := range metaplex.Creators {
+		path := fmt.Sprintf("$.output.metaplex.creators[%d]", n)
+		if !solanaAddress.MatchString(creator.Address) {
+			v.add(path+".address", "%q is not a solana address", creator.Address)
+		}
+		if creator.Share < 0 {
+			v.add(path+".share", "share can not be negative")
+		}
+		total += creator.Share
+	}
+	if total != 100 {
+		v.add("$.output.metaplex.creators", "creator shares must add up to 100, got %d", total)
+	}
+}
+
+func (v *validator) validateTezos() {
+	for n, creator := range v.config.Output.Tezos.Creators {
+		if !tezosAddress.MatchString(creator) {
+			v.add(fmt.Sprintf("$.output.tezos.creators[%d]", n), "%q is not a tezos address", creator)
+		}
+	}
+}
+
+func (v *validator) validateCardano() {
+	if !policyID.MatchString(v.config.Output.Cardano.PolicyID) {
+		v.add("$.output.cardano.policy-id", "policy id must be 56 hex characters, got %q", v.config.Output.Cardano.PolicyID)
+	}
+	if last := cip25AssetName(v.config.Output, int(v.config.Output.ImageCount)-1); len(last) > 32 {
+		v.add("$.output.cardano.asset-prefix", "asset names can be at most 32 bytes, %q is %d", last, len(last))
+	}
+	for _, key := range longCIP25Keys(v.config) {
+		v.add(key.path, "cip25 attribute keys can be at most %d bytes, %q is %d", cip25Limit, key.name, len(key.name))
+	}
+}
+
+func (v *validator) validateLocalization() {
+	localization := v.config.Output.ERC1155.Localization
+	if localization.URI == "" {
+		return
+	}
+	if !strings.Contains(localization.URI, "{locale}") {
+		v.add("$.output.erc1155.localization.uri", "uri %q needs a {locale} placeholder", localization.URI)
+	}
+	if !utils.Contains(localization.Locales, localization.Default) {
+		v.add("$.output.erc1155.localization.default", "default locale %q is not one of the locales", localization.Default)
+	}
+}
+
+// validateCollectionFiles rejects the outputs written as a single file for the whole collection, which
+// only go to the output directory
+func (v *validator) validateCollectionFiles() {
+	output := v.config.Output
+	if output.IncludeMeta {
+		switch output.MetaFormat {
+		case conf.JSONL, conf.CSV, conf.CIP25:
+			v.add("$.output.meta-format", "%s metadata is written as a single file, which needs output.local.directory", output.MetaFormat)
+		}
+		if output.CSV && output.MetaFormat != conf.CSV {
+			v.add("$.output.csv", "meta.csv can only be written along with output.local.directory")
+		}
+	}
+	if output.Manifest {
+		v.add("$.output.manifest", "collection.json can only be written along with output.local.directory")
+	}
+}
+
+func (v *validator) validateOutput() {
+	if v.config.Output.ImageCount <= 0 {
+		v.add("$.output.image-count", "image count must be positive")
+		return
+	}
+	switch v.config.Output.MetaFormat {
+	case conf.JSON, conf.CSV, conf.JSONL:
+	case conf.Metaplex:
+		v.validateMetaplex()
+	case conf.TZIP21:
+		v.validateTezos()
+	case conf.CIP25:
+		v.validateCardano()
+	case conf.ERC1155:
+		v.validateLocalization()
+	default:
+		if v.config.Output.IncludeMeta {
+			v.add("$.output.meta-format", "unsupported meta format %q", v.config.Output.MetaFormat)
+		}
+	}
+	switch v.config.Output.RarityRank.Method {
+	case "", conf.StatisticalRarity, conf.RarityScore:
+	default:
+		v.add("$.output.rarity-rank.method", "unsupported rarity method %q, supported methods are statistical and rarity-score", v.config.Output.RarityRank.Method)
+	}
+	if v.config.Output.RarityRank.Inject && v.config.Output.RarityRank.Method == "" {
+		v.add("$.output.rarity-rank.inject", "injecting ranks requires a rarity method")
+	}
+	switch v.config.Output.ImageFormat {
+	case "", conf.PNG, conf.JPEG, conf.GIF, conf.WebP:
+	default:
+		v.add("$.output.image-format", "unsupported image format %q, supported formats are png, jpeg, gif and webp", v.config.Output.ImageFormat)
+	}
+	if _, err := pngCompression(v.config.Output.PNGCompression); err != nil {
+		v.add("$.output.png-compression", "%s, supported levels are default, none, best-speed and best-compression", err)
+	}
+	if q := v.config.Output.JPEGQuality; q < 0 || q > 100 {
+		v.add("$.output.jpeg-quality", "quality must be between 1 and 100, got %d", q)
+	}
+	if _, err := jpegBackground(v.config.Output.JPEGBackground); err != nil {
+		v.add("$.output.jpeg-background", "%s", err)
+	}
+	if c := v.config.Output.GIFColors; c < 0 || c > 256 {
+		v.add("$.output.gif-colors", "colors must be between 1 and 256, got %d", c)
+	}
+	if v.config.Output.BaseURI != "" && v.config.Output.ImageURI != "" {
+		v.add("$.output.base-uri", "base-uri is ignored when image-uri is set")
+	}
+	if v.config.Output.CARFile != "" && v.config.Output.Local.Directory == "" {
+		v.add("$.output.car-file", "a car file can only be written along with output.local.directory")
+	}
+	if v.config.Output.Local.Directory == "" {
+		v.validateCollectionFiles()
+	}
+	if v.config.Output.EmbedMeta {
+		if imageFormat(v.config.Output) != conf.PNG {
+			v.add("$.output.embed-meta", "metadata can only be embedded in png images")
+		}
+		if !v.config.Output.IncludeMeta {
+			v.add("$.output.embed-meta", "embedding metadata requires include-meta")
+		}
+	}
+	if len(v.problems) > 0 {
+		return
+	}
+	if _, err := newSupplyTracker(v.config, int(v.config.Output.ImageCount)); err != nil {
+		v.add("$.attributes", "%s", err)
+	}
+}
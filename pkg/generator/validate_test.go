@@ -0,0 +1,61 @@
+package generator
+
+import (
+	"testing"
+
+	conf "github.com/clickpop/looks/pkg/config"
+)
+
+// outputProblems returns the paths of the problems validateOutput finds
+func outputProblems(config *conf.Config) []string {
+	v := &validator{config: config}
+	v.validateOutput()
+	paths := make([]string, 0, len(v.problems))
+	for _, problem := range v.problems {
+		paths = append(paths, problem.Path)
+	}
+	return paths
+}
+
+func TestValidateCollectionFilesNeedDirectory(t *testing.T) {
+	tests := []struct {
+		name   string
+		output func(output *conf.OutputObject)
+		want   string
+	}{
+		{"jsonl", func(output *conf.OutputObject) { output.MetaFormat = conf.JSONL }, "$.output.meta-format"},
+		{"csv format", func(output *conf.OutputObject) { output.MetaFormat = conf.CSV }, "$.output.meta-format"},
+		{"csv alongside", func(output *conf.OutputObject) { output.CSV = true }, "$.output.csv"},
+		{"manifest", func(output *conf.OutputObject) { output.Manifest = true }, "$.output.manifest"},
+	}
+	for _, test := range tests {
+		config := testConfig(3)
+		config.Output.IncludeMeta = true
+		config.Output.MetaFormat = conf.JSON
+		config.Output.IPFS = true
+		test.output(&config.Output)
+		if paths := outputProblems(config); len(paths) != 1 || paths[0] != test.want {
+			t.Errorf("%s without an output directory: problems at %v, want %s", test.name, paths, test.want)
+		}
+		config.Output.Local.Directory = "out"
+		if paths := outputProblems(config); len(paths) != 0 {
+			t.Errorf("%s with an output directory: problems at %v", test.name, paths)
+		}
+	}
+}
+
+func TestEmbedMetaNeedsIncludeMeta(t *testing.T) {
+	config := testConfig(3)
+	config.Output.EmbedMeta = true
+	if paths := outputProblems(config); len(paths) != 1 || paths[0] != "$.output.embed-meta" {
+		t.Errorf("problems at %v, want $.output.embed-meta", paths)
+	}
+	if _, err := New(config); err == nil {
+		t.Error("expected New to reject embed-meta without include-meta")
+	}
+	config.Output.IncludeMeta = true
+	config.Output.MetaFormat = conf.JSON
+	if _, err := New(config); err != nil {
+		t.Errorf("unexpected error with include-meta: %s", err)
+	}
+}
@@ -0,0 +1,71 @@
+package ipfs
+
+import (
+	"io"
+)
+
+// CarWriter writes blocks to a CARv1 archive, each block at most once
+type CarWriter struct {
+	w    io.Writer
+	seen map[CID]bool
+}
+
+// NewCarWriter writes the header of an archive with the given roots
+func NewCarWriter(w io.Writer, roots []CID) (*CarWriter, error) {
+	// dag-cbor map {"roots": [cids], "version": 1}, keys in canonical order
+	header := []byte{0xa2}
+	header = appendCborString(header, "roots")
+	header = appendCborHead(header, 4, uint64(len(roots)))
+	for _, root := range roots {
+		// tag 42 wraps a CID prefixed with the identity multibase byte
+		header = append(header, 0xd8, 0x2a)
+		header = appendCborHead(header, 2, uint64(len(root.bytes)+1))
+		header = append(header, 0)
+		header = append(header, root.bytes...)
+	}
+	header = appendCborString(header, "version")
+	header = appendCborHead(header, 0, 1)
+
+	if _, err := w.Write(appendVarint(nil, uint64(len(header)))); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &CarWriter{w: w, seen: make(map[CID]bool)}, nil
+}
+
+// Write adds a block to the archive unless it was written before
+func (c *CarWriter) Write(block Block) error {
+	if c.seen[block.CID] {
+		return nil
+	}
+	c.seen[block.CID] = true
+	section := appendVarint(nil, uint64(len(block.CID.bytes)+len(block.Data)))
+	section = append(section, block.CID.bytes...)
+	if _, err := c.w.Write(section); err != nil {
+		return err
+	}
+	_, err := c.w.Write(block.Data)
+	return err
+}
+
+func appendCborHead(buf []byte, major byte, v uint64) []byte {
+	major <<= 5
+	switch {
+	case v < 24:
+		return append(buf, major|byte(v))
+	case v <= 0xff:
+		return append(buf, major|24, byte(v))
+	case v <= 0xffff:
+		return append(buf, major|25, byte(v>>8), byte(v))
+	case v <= 0xffffffff:
+		return append(buf, major|26, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	return append(buf, major|27, byte(v>>56), byte(v>>48), byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendCborString(buf []byte, s string) []byte {
+	buf = appendCborHead(buf, 3, uint64(len(s)))
+	return append(buf, s...)
+}
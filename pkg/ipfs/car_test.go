@@ -0,0 +1,52 @@
+package ipfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestCarWriterWritesBlocksOnce(t *testing.T) {
+	// the two chunks of the test data are the same, so the file dag already repeats a block
+	var blocks []Block
+	seen := make(map[CID]bool)
+	link, err := File(testData(2*chunkSize), func(block Block) error {
+		if !seen[block.CID] {
+			blocks = append(blocks, block)
+			seen[block.CID] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	car, err := NewCarWriter(&buf, []CID{link.CID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, block := range append(blocks, blocks...) {
+		if err := car.Write(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data := buf.Bytes()
+	headerSize, n := binary.Uvarint(data)
+	header := data[n : n+int(headerSize)]
+	if !bytes.Contains(header, link.CID.Bytes()) || !bytes.Contains(header, []byte("version")) {
+		t.Errorf("header % x does not list the root", header)
+	}
+	sections := 0
+	for rest := data[n+int(headerSize):]; len(rest) > 0; sections++ {
+		size, n := binary.Uvarint(rest)
+		section := rest[n : n+int(size)]
+		if !bytes.HasPrefix(section, blocks[sections].CID.Bytes()) {
+			t.Errorf("section %d does not start with the CID of its block", sections)
+		}
+		rest = rest[n+int(size):]
+	}
+	if sections != len(blocks) {
+		t.Errorf("archive holds %d blocks, want %d", sections, len(blocks))
+	}
+}
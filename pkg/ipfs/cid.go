@@ -0,0 +1,74 @@
+// Package ipfs computes IPFS content identifiers for files and directories offline, laying out
+// the data the way Kubo does by default with CIDv1: 256 KiB chunks stored as raw leaves,
+// balanced file trees of at most 174 links per node and HAMT sharded directories above 256 KiB
+package ipfs
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+)
+
+const (
+	codecRaw    = 0x55
+	codecDagPB  = 0x70
+	hashSHA256  = 0x12
+	cidVersion1 = 1
+)
+
+var base32Lower = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// CID is a version 1 content identifier using sha2-256
+type CID struct {
+	bytes string
+}
+
+func newCID(codec uint64, data []byte) CID {
+	digest := sha256.Sum256(data)
+	buf := appendVarint(nil, cidVersion1)
+	buf = appendVarint(buf, codec)
+	buf = appendVarint(buf, hashSHA256)
+	buf = appendVarint(buf, uint64(len(digest)))
+	buf = append(buf, digest[:]...)
+	return CID{bytes: string(buf)}
+}
+
+// Defined reports if the CID was computed, the zero CID is undefined
+func (c CID) Defined() bool {
+	return c.bytes != ""
+}
+
+// Bytes returns the binary form of the CID
+func (c CID) Bytes() []byte {
+	return []byte(c.bytes)
+}
+
+// String returns the CID in base32, the default text form of CIDv1
+func (c CID) String() string {
+	return "b" + base32Lower.EncodeToString(c.Bytes())
+}
+
+// Block is a serialized node and its CID
+type Block struct {
+	CID  CID
+	Data []byte
+}
+
+func appendVarint(buf []byte, v uint64) []byte {
+	tmp := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(tmp, v)
+	return append(buf, tmp[:n]...)
+}
+
+// appendField appends a length delimited protobuf field
+func appendField(buf []byte, field int, data []byte) []byte {
+	buf = appendVarint(buf, uint64(field<<3|2))
+	buf = appendVarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
+
+// appendUint appends a varint protobuf field
+func appendUint(buf []byte, field int, v uint64) []byte {
+	buf = appendVarint(buf, uint64(field<<3))
+	return appendVarint(buf, v)
+}
@@ -0,0 +1,161 @@
+package ipfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+const (
+	hamtFanout  = 256
+	hashMurmur3 = 0x22
+)
+
+// shard is a node of a HAMT directory. Every slot holds either an entry or a child shard
+type shard struct {
+	entries  [hamtFanout]*Link
+	children [hamtFanout]*shard
+}
+
+func hamtDirectory(entries []Link, emit Emit) (Link, error) {
+	root := &shard{}
+	for i := range entries {
+		if err := root.insert(&entries[i], 0); err != nil {
+			return Link{}, err
+		}
+	}
+	return root.build(emit)
+}
+
+// insert places an entry in the slot picked by the depth-th byte of the hash of its name
+func (s *shard) insert(entry *Link, depth int) error {
+	hash := murmur3Hash([]byte(entry.Name))
+	if depth >= len(hash) {
+		return fmt.Errorf("hash collision on directory entry %q", entry.Name)
+	}
+	slot := hash[depth]
+	switch {
+	case s.children[slot] != nil:
+		return s.children[slot].insert(entry, depth+1)
+	case s.entries[slot] != nil:
+		child := &shard{}
+		if err := child.insert(s.entries[slot], depth+1); err != nil {
+			return err
+		}
+		if err := child.insert(entry, depth+1); err != nil {
+			return err
+		}
+		s.entries[slot] = nil
+		s.children[slot] = child
+	default:
+		s.entries[slot] = entry
+	}
+	return nil
+}
+
+func (s *shard) build(emit Emit) (Link, error) {
+	var links []Link
+	bitfield := make([]byte, hamtFanout/8)
+	for slot := 0; slot < hamtFanout; slot++ {
+		prefix := fmt.Sprintf("%02X", slot)
+		switch {
+		case s.children[slot] != nil:
+			link, err := s.children[slot].build(emit)
+			if err != nil {
+				return Link{}, err
+			}
+			link.Name = prefix
+			links = append(links, link)
+		case s.entries[slot] != nil:
+			link := *s.entries[slot]
+			link.Name = prefix + link.Name
+			links = append(links, link)
+		default:
+			continue
+		}
+		bitfield[len(bitfield)-1-slot/8] |= 1 << (slot % 8)
+	}
+	for len(bitfield) > 0 && bitfield[0] == 0 {
+		bitfield = bitfield[1:]
+	}
+
+	data := appendUint(nil, 1, unixfsHAMTShard)
+	data = appendField(data, 2, bitfield)
+	data = appendUint(data, 5, hashMurmur3)
+	data = appendUint(data, 6, hamtFanout)
+	return addNode(links, data, emit)
+}
+
+// murmur3Hash returns the first half of the 128 bit x64 murmur3 hash of data, big endian
+func murmur3Hash(data []byte) []byte {
+	const (
+		c1 = 0x87c37b91114253d5
+		c2 = 0x4cf5ad432745937f
+	)
+	var h1, h2 uint64
+	length := len(data)
+	for len(data) >= 16 {
+		k1 := binary.LittleEndian.Uint64(data)
+		k2 := binary.LittleEndian.Uint64(data[8:])
+		data = data[16:]
+
+		k1 *= c1
+		k1 = bits.RotateLeft64(k1, 31)
+		k1 *= c2
+		h1 ^= k1
+		h1 = bits.RotateLeft64(h1, 27)
+		h1 += h2
+		h1 = h1*5 + 0x52dce729
+
+		k2 *= c2
+		k2 = bits.RotateLeft64(k2, 33)
+		k2 *= c1
+		h2 ^= k2
+		h2 = bits.RotateLeft64(h2, 31)
+		h2 += h1
+		h2 = h2*5 + 0x38495ab5
+	}
+
+	var k1, k2 uint64
+	for i := len(data) - 1; i >= 8; i-- {
+		k2 ^= uint64(data[i]) << (8 * uint(i-8))
+	}
+	if len(data) > 8 {
+		k2 *= c2
+		k2 = bits.RotateLeft64(k2, 33)
+		k2 *= c1
+		h2 ^= k2
+	}
+	for i := len(data) - 1; i >= 0; i-- {
+		if i < 8 {
+			k1 ^= uint64(data[i]) << (8 * uint(i))
+		}
+	}
+	if len(data) > 0 {
+		k1 *= c1
+		k1 = bits.RotateLeft64(k1, 31)
+		k1 *= c2
+		h1 ^= k1
+	}
+
+	h1 ^= uint64(length)
+	h2 ^= uint64(length)
+	h1 += h2
+	h2 += h1
+	h1 = fmix64(h1)
+	h2 = fmix64(h2)
+	h1 += h2
+
+	sum := make([]byte, 8)
+	binary.BigEndian.PutUint64(sum, h1)
+	return sum
+}
+
+func fmix64(k uint64) uint64 {
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	k *= 0xc4ceb9fe1a85ec53
+	k ^= k >> 33
+	return k
+}
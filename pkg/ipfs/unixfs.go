@@ -0,0 +1,128 @@
+package ipfs
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	chunkSize     = 256 << 10
+	maxLinks      = 174
+	shardingLimit = 256 << 10
+
+	unixfsDirectory = 1
+	unixfsFile      = 2
+	unixfsHAMTShard = 5
+)
+
+// Link points to a file or directory. Size is the cumulative size of the blocks below it
+type Link struct {
+	Name string
+	CID  CID
+	Size uint64
+}
+
+// Emit receives every block of a dag as it is built, children before their parents
+type Emit func(block Block) error
+
+func (emit Emit) block(block Block) error {
+	if emit == nil {
+		return nil
+	}
+	return emit(block)
+}
+
+// encodeNode serializes a dag-pb node with its links sorted by name
+func encodeNode(links []Link, data []byte) []byte {
+	sorted := make([]Link, len(links))
+	copy(sorted, links)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	var buf []byte
+	for _, link := range sorted {
+		pbLink := appendField(nil, 1, link.CID.Bytes())
+		pbLink = appendField(pbLink, 2, []byte(link.Name))
+		pbLink = appendUint(pbLink, 3, link.Size)
+		buf = appendField(buf, 2, pbLink)
+	}
+	return appendField(buf, 1, data)
+}
+
+// addNode emits a dag-pb node and returns a link to it
+func addNode(links []Link, data []byte, emit Emit) (Link, error) {
+	node := encodeNode(links, data)
+	size := uint64(len(node))
+	for _, link := range links {
+		size += link.Size
+	}
+	block := Block{CID: newCID(codecDagPB, node), Data: node}
+	return Link{CID: block.CID, Size: size}, emit.block(block)
+}
+
+// File builds the dag of a file and returns a link to its root
+func File(data []byte, emit Emit) (Link, error) {
+	type fileNode struct {
+		link     Link
+		fileSize uint64
+	}
+	var level []fileNode
+	for offset := 0; offset == 0 || offset < len(data); offset += chunkSize {
+		end := offset + chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk := data[offset:end]
+		block := Block{CID: newCID(codecRaw, chunk), Data: chunk}
+		if err := emit.block(block); err != nil {
+			return Link{}, err
+		}
+		level = append(level, fileNode{link: Link{CID: block.CID, Size: uint64(len(chunk))}, fileSize: uint64(len(chunk))})
+	}
+
+	for len(level) > 1 {
+		var parents []fileNode
+		for start := 0; start < len(level); start += maxLinks {
+			end := start + maxLinks
+			if end > len(level) {
+				end = len(level)
+			}
+			links := make([]Link, 0, end-start)
+			var fileSize uint64
+			meta := appendUint(nil, 1, unixfsFile)
+			var blockSizes []byte
+			for _, child := range level[start:end] {
+				links = append(links, child.link)
+				fileSize += child.fileSize
+				blockSizes = appendUint(blockSizes, 4, child.fileSize)
+			}
+			meta = appendUint(meta, 3, fileSize)
+			meta = append(meta, blockSizes...)
+			link, err := addNode(links, meta, emit)
+			if err != nil {
+				return Link{}, err
+			}
+			parents = append(parents, fileNode{link: link, fileSize: fileSize})
+		}
+		level = parents
+	}
+	return level[0].link, nil
+}
+
+// Directory builds a directory holding the entries and returns a link to it. Like Kubo, the
+// directory is sharded once the names and CIDs of its entries add up to 256 KiB
+func Directory(entries []Link, emit Emit) (Link, error) {
+	names := make(map[string]bool, len(entries))
+	estimated := 0
+	for _, entry := range entries {
+		if names[entry.Name] {
+			return Link{}, fmt.Errorf("duplicate directory entry %q", entry.Name)
+		}
+		names[entry.Name] = true
+		estimated += len(entry.Name) + len(entry.CID.bytes)
+	}
+	if estimated >= shardingLimit {
+		return hamtDirectory(entries, emit)
+	}
+	return addNode(entries, appendUint(nil, 1, unixfsDirectory), emit)
+}
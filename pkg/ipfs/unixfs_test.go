@@ -0,0 +1,96 @@
+package ipfs
+
+import (
+	"fmt"
+	"testing"
+)
+
+// testData returns n bytes that do not repeat within a chunk, the same as the fixtures were added from
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + i>>8)
+	}
+	return data
+}
+
+// The CIDs below were computed by Kubo 0.32.1 with ipfs add --cid-version=1, adding -r for directories
+
+func TestFile(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		cid  string
+	}{
+		{"empty", []byte{}, "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku"},
+		{"small", []byte("looks\n"), "bafkreif7dv3ljgj33dm7jdll6ytoqc6zde62bn7umncexeohkfkqkyshny"},
+		{"single chunk", testData(chunkSize), "bafkreibdffnmnzlbq264m4kqmxcslchnncczdb567t7xahpgbhdyigvtr4"},
+		{"multiple chunks", testData(4*chunkSize + 1), "bafybeid6x5h7imlgta56khgtf7mpym35vczu7j42tshlbfdjvci3mzt7qe"},
+		{"two levels", testData((maxLinks+1)*chunkSize + 5), "bafybeibjzuycakaqx6nfwdbvy4q23aon7666mobksatgjzuiefnvshyubi"},
+	}
+	for _, test := range tests {
+		blocks := 0
+		link, err := File(test.data, func(block Block) error {
+			if got := newCID(uint64(block.CID.bytes[1]), block.Data); got != block.CID {
+				t.Errorf("%s: block %s does not hash to its CID", test.name, block.CID)
+			}
+			blocks++
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if got := link.CID.String(); got != test.cid {
+			t.Errorf("%s: CID %s, want %s", test.name, got, test.cid)
+		}
+		if blocks == 0 {
+			t.Errorf("%s: no blocks emitted", test.name)
+		}
+	}
+}
+
+func TestDirectory(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries int
+		file    func(i int) (string, []byte)
+		cid     string
+	}{
+		{"plain", 3, func(i int) (string, []byte) {
+			return fmt.Sprintf("%d.json", i), []byte(fmt.Sprintf(`{"name":"%d"}`, i))
+		}, "bafybeie7peomj5vp4b7sij4marcnihwk3nfxmg74xdaigci4xevbzcf6ya"},
+		{"sharded", 6000, func(i int) (string, []byte) {
+			return fmt.Sprintf("%05d.json", i), []byte(fmt.Sprint(i))
+		}, "bafybeieo2zzapdsrqydzn3kmtaj3uxuwugzqxud6qtxi4ins4xileppmle"},
+	}
+	for _, test := range tests {
+		entries := make([]Link, 0, test.entries)
+		for i := 0; i < test.entries; i++ {
+			name, data := test.file(i)
+			link, err := File(data, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			link.Name = name
+			entries = append(entries, link)
+		}
+		link, err := Directory(entries, nil)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if got := link.CID.String(); got != test.cid {
+			t.Errorf("%s: CID %s, want %s", test.name, got, test.cid)
+		}
+	}
+}
+
+func TestDirectoryRejectsDuplicateNames(t *testing.T) {
+	link, err := File([]byte("looks\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link.Name = "0.json"
+	if _, err := Directory([]Link{link, link}, nil); err == nil {
+		t.Error("expected an error for two entries with the same name")
+	}
+}
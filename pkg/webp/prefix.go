@@ -0,0 +1,289 @@
+package webp
+
+import "sort"
+
+// codeLengthOrder is the order code length code lengths are written in
+var codeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// bitWriter packs bits least significant first
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	count uint
+}
+
+func (w *bitWriter) write(value uint32, bits uint) {
+	w.acc |= uint64(value) << w.count
+	w.count += bits
+	for w.count >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.count -= 8
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	if w.count > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.count = 0, 0
+	}
+	return w.buf
+}
+
+// prefixCode is a canonical Huffman code. Codes are stored bit reversed, ready to be written
+// least significant bit first
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint16
+	// simple holds the symbols of a code written as a simple code, a single symbol takes no bits
+	simple []int
+}
+
+// newPrefixCode builds the code of a histogram, as a simple code when it has at most two symbols below 256
+func newPrefixCode(histogram []int, limit int) *prefixCode {
+	used := usedSymbols(histogram)
+	if len(used) <= 2 && (len(used) == 0 || used[len(used)-1] < 256) {
+		c := &prefixCode{lengths: make([]uint8, len(histogram)), simple: used}
+		switch len(used) {
+		case 0:
+			c.simple = []int{0}
+		case 2:
+			c.lengths[used[0]], c.lengths[used[1]] = 1, 1
+		}
+		c.codes = canonicalCodes(c.lengths)
+		return c
+	}
+	lengths := codeLengths(histogram, used, limit)
+	return &prefixCode{lengths: lengths, codes: canonicalCodes(lengths)}
+}
+
+func usedSymbols(histogram []int) []int {
+	var used []int
+	for symbol, count := range histogram {
+		if count > 0 {
+			used = append(used, symbol)
+		}
+	}
+	return used
+}
+
+func (c *prefixCode) writeSymbol(w *bitWriter, symbol int) {
+	w.write(uint32(c.codes[symbol]), uint(c.lengths[symbol]))
+}
+
+// writeTo writes a simple code as its symbols, otherwise the code lengths compressed with a code length code
+func (c *prefixCode) writeTo(w *bitWriter) {
+	if symbols := c.simple; symbols != nil {
+		w.write(1, 1)
+		w.write(uint32(len(symbols)-1), 1)
+		if symbols[0] <= 1 {
+			w.write(0, 1)
+			w.write(uint32(symbols[0]), 1)
+		} else {
+			w.write(1, 1)
+			w.write(uint32(symbols[0]), 8)
+		}
+		if len(symbols) == 2 {
+			w.write(uint32(symbols[1]), 8)
+		}
+		return
+	}
+
+	w.write(0, 1)
+	tokens := runLengths(c.lengths)
+	histogram := make([]int, len(codeLengthOrder))
+	for _, token := range tokens {
+		histogram[token.symbol]++
+	}
+	lengths := codeLengths(histogram, usedSymbols(histogram), 7)
+	lengthCode := &prefixCode{lengths: lengths, codes: canonicalCodes(lengths)}
+	count := len(codeLengthOrder)
+	for count > 4 && lengthCode.lengths[codeLengthOrder[count-1]] == 0 {
+		count--
+	}
+	w.write(uint32(count-4), 4)
+	for _, symbol := range codeLengthOrder[:count] {
+		w.write(uint32(lengthCode.lengths[symbol]), 3)
+	}
+	w.write(0, 1) // code lengths cover the whole alphabet
+	for _, token := range tokens {
+		lengthCode.writeSymbol(w, token.symbol)
+		w.write(uint32(token.extra), token.extraBits)
+	}
+}
+
+type lengthToken struct {
+	symbol    int
+	extraBits uint
+	extra     int
+}
+
+// runLengths compresses code lengths with the repeat symbols 16, 17 and 18
+func runLengths(lengths []uint8) []lengthToken {
+	var tokens []lengthToken
+	previous := uint8(8)
+	for i := 0; i < len(lengths); {
+		value := lengths[i]
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == value {
+			run++
+		}
+		i += run
+		if value == 0 {
+			for run >= 3 {
+				if run >= 11 {
+					n := run
+					if n > 138 {
+						n = 138
+					}
+					tokens = append(tokens, lengthToken{symbol: 18, extraBits: 7, extra: n - 11})
+					run -= n
+				} else {
+					n := run
+					if n > 10 {
+						n = 10
+					}
+					tokens = append(tokens, lengthToken{symbol: 17, extraBits: 3, extra: n - 3})
+					run -= n
+				}
+			}
+		} else {
+			if value != previous {
+				tokens = append(tokens, lengthToken{symbol: int(value)})
+				run--
+				previous = value
+			}
+			for run >= 3 {
+				n := run
+				if n > 6 {
+					n = 6
+				}
+				tokens = append(tokens, lengthToken{symbol: 16, extraBits: 2, extra: n - 3})
+				run -= n
+			}
+		}
+		for ; run > 0; run-- {
+			tokens = append(tokens, lengthToken{symbol: int(value)})
+		}
+	}
+	return tokens
+}
+
+// codeLengths builds Huffman code lengths of at most limit bits for the used symbols of a histogram.
+// Counts are halved until the lengths fit, which keeps the code complete. A single used symbol is
+// paired with a second one so the code stays complete
+func codeLengths(histogram []int, used []int, limit int) []uint8 {
+	lengths := make([]uint8, len(histogram))
+	switch len(used) {
+	case 0:
+		return lengths
+	case 1:
+		other := 0
+		if used[0] == 0 {
+			other = 1
+		}
+		lengths[used[0]], lengths[other] = 1, 1
+		return lengths
+	}
+
+	counts := make([]int, len(used))
+	for i, symbol := range used {
+		counts[i] = histogram[symbol]
+	}
+	for {
+		depths := huffmanDepths(counts)
+		fits := true
+		for _, depth := range depths {
+			if depth > limit {
+				fits = false
+				break
+			}
+		}
+		if fits {
+			for i, symbol := range used {
+				lengths[symbol] = uint8(depths[i])
+			}
+			return lengths
+		}
+		for i := range counts {
+			counts[i] = (counts[i] + 1) / 2
+		}
+	}
+}
+
+// huffmanDepths returns the depth of every leaf of a Huffman tree over counts, at least two of them
+func huffmanDepths(counts []int) []int {
+	type node struct {
+		count  int
+		parent int
+	}
+	nodes := make([]node, len(counts), 2*len(counts)-1)
+	order := make([]int, len(counts))
+	for i, count := range counts {
+		nodes[i] = node{count: count, parent: -1}
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return counts[order[a]] < counts[order[b]] })
+
+	// two queue construction: sorted leaves and internal nodes, which are created in increasing order
+	leaves, internal := order, make([]int, 0, len(counts)-1)
+	pop := func() int {
+		if len(internal) == 0 || (len(leaves) > 0 && nodes[leaves[0]].count <= nodes[internal[0]].count) {
+			n := leaves[0]
+			leaves = leaves[1:]
+			return n
+		}
+		n := internal[0]
+		internal = internal[1:]
+		return n
+	}
+	for len(leaves)+len(internal) > 1 {
+		a, b := pop(), pop()
+		nodes = append(nodes, node{count: nodes[a].count + nodes[b].count, parent: -1})
+		nodes[a].parent = len(nodes) - 1
+		nodes[b].parent = len(nodes) - 1
+		internal = append(internal, len(nodes)-1)
+	}
+
+	depths := make([]int, len(counts))
+	for i := range counts {
+		for n := i; nodes[n].parent >= 0; n = nodes[n].parent {
+			depths[i]++
+		}
+	}
+	return depths
+}
+
+// canonicalCodes assigns codes in symbol order within each length, as DEFLATE does
+func canonicalCodes(lengths []uint8) []uint16 {
+	var lengthCount [16]int
+	for _, length := range lengths {
+		if length > 0 {
+			lengthCount[length]++
+		}
+	}
+	var next [16]int
+	code := 0
+	for length := 1; length < 16; length++ {
+		code = (code + lengthCount[length-1]) << 1
+		next[length] = code
+	}
+	codes := make([]uint16, len(lengths))
+	for symbol, length := range lengths {
+		if length == 0 {
+			continue
+		}
+		codes[symbol] = reverseBits(uint16(next[length]), length)
+		next[length]++
+	}
+	return codes
+}
+
+func reverseBits(code uint16, length uint8) uint16 {
+	var reversed uint16
+	for i := uint8(0); i < length; i++ {
+		reversed = reversed<<1 | code&1
+		code >>= 1
+	}
+	return reversed
+}
@@ -0,0 +1,271 @@
+// Package webp writes lossless WebP (VP8L) images.
+//
+// The encoder keeps to a small subset of the format: the subtract green transform, LZ77 backward
+// references and a single group of prefix codes, which is enough for layered artwork with flat colors
+package webp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+const (
+	maxDimension = 1 << 14
+
+	// the distance codes below distanceOffset map to pixels around the current one
+	distanceOffset = 120
+	// maxDistance keeps the largest distance within the 40 distance prefix codes
+	maxDistance = 1<<20 - distanceOffset
+
+	numLiterals      = 256
+	numLengthCodes   = 24
+	numDistanceCodes = 40
+
+	transformSubtractGreen = 2
+)
+
+// Encode writes img to w as a lossless WebP image. Colors are stored without premultiplied alpha
+func Encode(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 1 || height < 1 || width > maxDimension || height > maxDimension {
+		return fmt.Errorf("webp images must be between 1 and %d pixels wide and high, got %dx%d", maxDimension, width, height)
+	}
+	argb, alpha := pixels(img)
+
+	bw := &bitWriter{}
+	bw.write(0x2f, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if alpha {
+		bw.write(1, 1)
+	} else {
+		bw.write(0, 1)
+	}
+	bw.write(0, 3)
+
+	bw.write(1, 1)
+	bw.write(transformSubtractGreen, 2)
+	subtractGreen(argb)
+	bw.write(0, 1)
+
+	encodeImageData(bw, argb, width)
+
+	data := bw.bytes()
+	padding := len(data) % 2
+	header := make([]byte, 20)
+	copy(header, "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(12+len(data)+padding))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(data)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(append(data, make([]byte, padding)...))
+	return err
+}
+
+// pixels returns the non-premultiplied ARGB value of every pixel and whether any of them is translucent
+func pixels(img image.Image) ([]uint32, bool) {
+	bounds := img.Bounds()
+	argb := make([]uint32, 0, bounds.Dx()*bounds.Dy())
+	alpha := false
+	if rgba, ok := img.(*image.RGBA); ok {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			row := rgba.Pix[rgba.PixOffset(bounds.Min.X, y):rgba.PixOffset(bounds.Max.X, y)]
+			for i := 0; i < len(row); i += 4 {
+				c := unpremultiply(row[i], row[i+1], row[i+2], row[i+3])
+				alpha = alpha || c.A != 0xff
+				argb = append(argb, uint32(c.A)<<24|uint32(c.R)<<16|uint32(c.G)<<8|uint32(c.B))
+			}
+		}
+		return argb, alpha
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			alpha = alpha || c.A != 0xff
+			argb = append(argb, uint32(c.A)<<24|uint32(c.R)<<16|uint32(c.G)<<8|uint32(c.B))
+		}
+	}
+	return argb, alpha
+}
+
+// unpremultiply converts like color.NRGBAModel without going through the color.Color interface
+func unpremultiply(r, g, b, a uint8) color.NRGBA {
+	switch a {
+	case 0xff:
+		return color.NRGBA{r, g, b, a}
+	case 0:
+		return color.NRGBA{}
+	}
+	a16 := uint32(a) * 0x101
+	scale := func(v uint8) uint8 {
+		return uint8((uint32(v) * 0x101 * 0xffff / a16) >> 8)
+	}
+	return color.NRGBA{scale(r), scale(g), scale(b), a}
+}
+
+// subtractGreen stores red and blue as their difference to green, the decoder adds green back
+func subtractGreen(argb []uint32) {
+	for i, p := range argb {
+		green := (p >> 8) & 0xff
+		red := ((p >> 16) - green) & 0xff
+		blue := (p - green) & 0xff
+		argb[i] = p&0xff00ff00 | red<<16 | blue
+	}
+}
+
+// symbol is either a literal pixel or a backward reference of length pixels
+type symbol struct {
+	argb     uint32
+	length   int
+	distance int
+}
+
+// encodeImageData writes the main image without color cache or meta prefix codes
+func encodeImageData(bw *bitWriter, argb []uint32, width int) {
+	symbols := backwardReferences(argb, width)
+
+	green := make([]int, numLiterals+numLengthCodes)
+	red := make([]int, numLiterals)
+	blue := make([]int, numLiterals)
+	alpha := make([]int, numLiterals)
+	distance := make([]int, numDistanceCodes)
+	for _, s := range symbols {
+		if s.length == 0 {
+			green[(s.argb>>8)&0xff]++
+			red[(s.argb>>16)&0xff]++
+			blue[s.argb&0xff]++
+			alpha[s.argb>>24]++
+			continue
+		}
+		code, _, _ := prefixEncode(s.length)
+		green[numLiterals+code]++
+		code, _, _ = prefixEncode(s.distance)
+		distance[code]++
+	}
+
+	bw.write(0, 1) // no color cache
+	bw.write(0, 1) // no meta prefix codes
+	codes := make([]*prefixCode, 5)
+	for i, histogram := range [][]int{green, red, blue, alpha, distance} {
+		codes[i] = newPrefixCode(histogram, 15)
+		codes[i].writeTo(bw)
+	}
+
+	for _, s := range symbols {
+		if s.length == 0 {
+			codes[0].writeSymbol(bw, int((s.argb>>8)&0xff))
+			codes[1].writeSymbol(bw, int((s.argb>>16)&0xff))
+			codes[2].writeSymbol(bw, int(s.argb&0xff))
+			codes[3].writeSymbol(bw, int(s.argb>>24))
+			continue
+		}
+		code, extraBits, extra := prefixEncode(s.length)
+		codes[0].writeSymbol(bw, numLiterals+code)
+		bw.write(uint32(extra), extraBits)
+		code, extraBits, extra = prefixEncode(s.distance)
+		codes[4].writeSymbol(bw, code)
+		bw.write(uint32(extra), extraBits)
+	}
+}
+
+const (
+	minMatch  = 3
+	maxMatch  = 4096
+	maxChain  = 32
+	hashBits  = 16
+	emptyHash = -1
+)
+
+// backwardReferences finds repeated runs of pixels with a hash chain over every three pixels.
+// The distance of a reference is stored as its distance code
+func backwardReferences(argb []uint32, width int) []symbol {
+	head := make([]int32, 1<<hashBits)
+	for i := range head {
+		head[i] = emptyHash
+	}
+	prev := make([]int32, len(argb))
+	hash := func(i int) uint32 {
+		h := argb[i]*0x1e35a7bd ^ argb[i+1]*0x9e3779b1 ^ argb[i+2]*0x85ebca6b
+		return h >> (32 - hashBits)
+	}
+	insert := func(i int) {
+		if i+minMatch > len(argb) {
+			return
+		}
+		h := hash(i)
+		prev[i] = head[h]
+		head[h] = int32(i)
+	}
+
+	symbols := make([]symbol, 0, len(argb)/4)
+	for i := 0; i < len(argb); {
+		bestLength, bestDistance := 0, 0
+		if i+minMatch <= len(argb) {
+			limit := len(argb) - i
+			if limit > maxMatch {
+				limit = maxMatch
+			}
+			candidate := head[hash(i)]
+			for chain := 0; candidate != emptyHash && chain < maxChain; chain++ {
+				distance := i - int(candidate)
+				if distance > maxDistance {
+					break
+				}
+				length := 0
+				for length < limit && argb[int(candidate)+length] == argb[i+length] {
+					length++
+				}
+				if length > bestLength {
+					bestLength, bestDistance = length, distance
+					if length == limit {
+						break
+					}
+				}
+				candidate = prev[candidate]
+			}
+		}
+		if bestLength < minMatch {
+			symbols = append(symbols, symbol{argb: argb[i]})
+			insert(i)
+			i++
+			continue
+		}
+		symbols = append(symbols, symbol{length: bestLength, distance: distanceCode(bestDistance, width)})
+		for end := i + bestLength; i < end; i++ {
+			insert(i)
+		}
+	}
+	return symbols
+}
+
+// distanceCode maps a distance in pixels to its code, using the short codes for the pixel above and the one to the left
+func distanceCode(distance int, width int) int {
+	switch distance {
+	case width:
+		return 1
+	case 1:
+		return 2
+	}
+	return distance + distanceOffset
+}
+
+// prefixEncode splits a length or distance code into its prefix symbol and extra bits
+func prefixEncode(value int) (int, uint, int) {
+	d := value - 1
+	if d < 4 {
+		return d, 0, 0
+	}
+	high := 0
+	for d>>uint(high+1) != 0 {
+		high++
+	}
+	second := (d >> uint(high-1)) & 1
+	extraBits := uint(high - 1)
+	return 2*high + second, extraBits, d & (1<<extraBits - 1)
+}
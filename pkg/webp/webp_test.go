@@ -0,0 +1,193 @@
+package webp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	xwebp "golang.org/x/image/webp"
+)
+
+func TestUnpremultiplyMatchesNRGBAModel(t *testing.T) {
+	for a := 0; a < 256; a++ {
+		for v := 0; v <= a; v++ {
+			want := color.NRGBAModel.Convert(color.RGBA{uint8(v), uint8(v), uint8(v), uint8(a)}).(color.NRGBA)
+			if got := unpremultiply(uint8(v), uint8(v), uint8(v), uint8(a)); got != want {
+				t.Fatalf("unpremultiply(%d, %d) = %v, want %v", v, a, got, want)
+			}
+		}
+	}
+}
+
+func TestPrefixEncodeRoundTrip(t *testing.T) {
+	for value := 1; value <= 1<<20; value++ {
+		code, extraBits, extra := prefixEncode(value)
+		// decoding as described in the VP8L specification
+		decoded := code + 1
+		if code >= 4 {
+			bits := uint(code-2) >> 1
+			if bits != extraBits {
+				t.Fatalf("prefixEncode(%d) has %d extra bits, code %d needs %d", value, extraBits, code, bits)
+			}
+			decoded = (2+code&1)<<bits + extra + 1
+		}
+		if decoded != value {
+			t.Fatalf("prefixEncode(%d) = %d, %d decodes to %d", value, code, extra, decoded)
+		}
+	}
+}
+
+func TestCodeLengthsAreCompleteAndLimited(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for n := 0; n < 200; n++ {
+		histogram := make([]int, 280)
+		for i := range histogram {
+			if rng.Intn(3) == 0 {
+				// skewed counts push the depths past the limit before halving
+				histogram[i] = 1 << uint(rng.Intn(24))
+			}
+		}
+		used := usedSymbols(histogram)
+		if len(used) < 2 {
+			continue
+		}
+		lengths := codeLengths(histogram, used, 15)
+		kraft := 0
+		for _, length := range lengths {
+			if length > 15 {
+				t.Fatalf("code length %d exceeds the limit", length)
+			}
+			if length > 0 {
+				kraft += 1 << (15 - length)
+			}
+		}
+		if kraft != 1<<15 {
+			t.Fatalf("code is not complete, kraft sum %d/%d", kraft, 1<<15)
+		}
+	}
+}
+
+func TestRunLengthsExpandToLengths(t *testing.T) {
+	lengths := make([]uint8, 280)
+	for i := 30; i < 40; i++ {
+		lengths[i] = 8
+	}
+	for i := 100; i < 103; i++ {
+		lengths[i] = 5
+	}
+	lengths[279] = 3
+	var expanded []uint8
+	previous := uint8(8)
+	for _, token := range runLengths(lengths) {
+		switch token.symbol {
+		case 16:
+			for i := 0; i < 3+token.extra; i++ {
+				expanded = append(expanded, previous)
+			}
+		case 17:
+			expanded = append(expanded, make([]uint8, 3+token.extra)...)
+		case 18:
+			expanded = append(expanded, make([]uint8, 11+token.extra)...)
+		default:
+			expanded = append(expanded, uint8(token.symbol))
+			if token.symbol != 0 {
+				previous = uint8(token.symbol)
+			}
+		}
+	}
+	if !bytes.Equal(expanded, lengths) {
+		t.Fatalf("run lengths expand to %v", expanded)
+	}
+}
+
+func TestEncodeHeader(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 300, 7))
+	img.Pix[3] = 0x80
+	var buf bytes.Buffer
+	if err := Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if string(data[0:4]) != "RIFF" || string(data[8:16]) != "WEBPVP8L" {
+		t.Fatalf("unexpected header % x", data[:16])
+	}
+	if size := binary.LittleEndian.Uint32(data[4:]); int(size) != len(data)-8 {
+		t.Errorf("riff size %d, file is %d bytes", size, len(data))
+	}
+	if len(data)%2 != 0 {
+		t.Errorf("file of %d bytes is not padded", len(data))
+	}
+	bits := binary.LittleEndian.Uint32(data[21:])
+	if data[20] != 0x2f || bits&0x3fff != 299 || bits>>14&0x3fff != 6 || bits>>28&1 != 1 || bits>>29 != 0 {
+		t.Errorf("unexpected vp8l header % x", data[20:25])
+	}
+}
+
+func TestEncodeRejectsLargeImages(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, maxDimension+1, 1))
+	if err := Encode(&bytes.Buffer{}, img); err == nil {
+		t.Fatal("expected an error for an image wider than the format allows")
+	}
+}
+
+func TestEncodeDecodesToSameImage(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	noise := image.NewNRGBA(image.Rect(0, 0, 67, 45))
+	rng.Read(noise.Pix)
+	gradient := image.NewNRGBA(image.Rect(0, 0, 300, 200))
+	transparent := image.NewNRGBA(image.Rect(0, 0, 40, 40))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 300; x++ {
+			gradient.SetNRGBA(x, y, color.NRGBA{uint8(x), uint8(y), uint8(x + y), 255})
+			if x < 40 && y < 40 && (x+y)%3 != 0 {
+				transparent.SetNRGBA(x, y, color.NRGBA{uint8(x * 6), 90, uint8(y * 6), uint8(x * y % 256)})
+			}
+		}
+	}
+	single := image.NewNRGBA(image.Rect(0, 0, 33, 17))
+	for i := 0; i < len(single.Pix); i += 4 {
+		copy(single.Pix[i:], []uint8{0x20, 0x40, 0x80, 0xff})
+	}
+	tests := []struct {
+		name string
+		img  *image.NRGBA
+	}{
+		{"noise", noise},
+		{"gradient", gradient},
+		{"transparent", transparent},
+		{"single colour", single},
+		{"single pixel", image.NewNRGBA(image.Rect(0, 0, 1, 1))},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := Encode(&buf, test.img); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		decoded, err := xwebp.Decode(&buf)
+		if err != nil {
+			t.Fatalf("%s: decoding: %s", test.name, err)
+		}
+		bounds := test.img.Bounds()
+		if decoded.Bounds() != bounds {
+			t.Fatalf("%s: decoded bounds %v, want %v", test.name, decoded.Bounds(), bounds)
+		}
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				want := test.img.NRGBAAt(x, y)
+				if want.A == 0 {
+					want = color.NRGBA{}
+				}
+				got := color.NRGBAModel.Convert(decoded.At(x, y)).(color.NRGBA)
+				if got.A == 0 {
+					got = color.NRGBA{}
+				}
+				if got != want {
+					t.Fatalf("%s: pixel (%d, %d) decodes to %v, want %v", test.name, x, y, got, want)
+				}
+			}
+		}
+	}
+}